@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// RequestBuilder builds a request step by step and sends it with Do. It is
+// returned by Request, its methods return the builder so calls can be
+// chained. A builder is meant for a single request.
+type RequestBuilder struct {
+	client *HttpClient
+	ctx    context.Context
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   io.Reader
+	json   bool
+	opts   []RequestOption
+	err    error
+}
+
+// Request returns a builder of a GET request to the base URL.
+func (c *HttpClient) Request() *RequestBuilder {
+	return &RequestBuilder{
+		client: c,
+		ctx:    context.Background(),
+		method: http.MethodGet,
+		query:  make(url.Values),
+		header: make(http.Header),
+	}
+}
+
+// Method sets the method of the request.
+func (b *RequestBuilder) Method(method string) *RequestBuilder {
+	b.method = method
+	return b
+}
+
+// Path sets the URL of the request, resolved against the base URL.
+func (b *RequestBuilder) Path(path string) *RequestBuilder {
+	b.path = path
+	return b
+}
+
+// Query adds a query parameter to the URL.
+func (b *RequestBuilder) Query(key, value string) *RequestBuilder {
+	b.query.Add(key, value)
+	return b
+}
+
+// Header adds a header to the request.
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	b.header.Add(key, value)
+	return b
+}
+
+// Body sets the body of the request.
+func (b *RequestBuilder) Body(body io.Reader) *RequestBuilder {
+	b.body, b.json = body, false
+	return b
+}
+
+// JSON sets the JSON encoding of v as the body of the request, with the
+// application/json Content-Type unless a header sets another one. An
+// encoding error is returned by Do.
+func (b *RequestBuilder) JSON(v interface{}) *RequestBuilder {
+	body, err := json.Marshal(v)
+	if err != nil {
+		b.err = errors.Wrap(err, "builder - json encoding failed")
+		return b
+	}
+	b.body, b.json = bytes.NewReader(body), true
+	return b
+}
+
+// Context sets the context of the request.
+func (b *RequestBuilder) Context(ctx context.Context) *RequestBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// Options adds overrides of the client settings for this request, see
+// DoWithOptions.
+func (b *RequestBuilder) Options(opts ...RequestOption) *RequestBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Do builds the request and sends it with DoWithOptions.
+func (b *RequestBuilder) Do() (*http.Response, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	request, err := b.client.newRequest(b.ctx, b.method, b.path, b.body, b.header)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.query) > 0 {
+		query := request.URL.Query()
+		for key, values := range b.query {
+			query[key] = append(query[key], values...)
+		}
+		request.URL.RawQuery = query.Encode()
+	}
+	if b.json && len(request.Header.Get("Content-Type")) == 0 {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return b.client.DoWithOptions(request, b.opts...)
+}
@@ -0,0 +1,76 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_RequestBuilder(t *testing.T) {
+	type userKey struct{}
+	client, doer, done := newClient(t,
+		WithBaseURL("https://api.example.com"),
+		WithRetryableMethods(http.MethodPost),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	var bodies []string
+	doer.EXPECT().Do(gomock.Any()).Times(3).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "https://api.example.com/v1/users?notify=true&tag=a&tag=b&v=1", req.URL.String())
+		assert.Equal(t, "value", req.Header.Get("X-Header"))
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+		assert.Equal(t, "john", req.Context().Value(userKey{}))
+		b, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		bodies = append(bodies, string(b))
+		return &http.Response{StatusCode: 503}, nil
+	})
+	resp, err := client.Request().
+		Method(http.MethodPost).
+		Path("/v1/users?v=1").
+		Query("notify", "true").
+		Query("tag", "a").
+		Query("tag", "b").
+		Header("X-Header", "value").
+		JSON(map[string]string{"name": "John"}).
+		Context(context.WithValue(context.Background(), userKey{}, "john")).
+		Options(WithRequestRetryCount(2)).
+		Do()
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, []string{`{"name":"John"}`, `{"name":"John"}`, `{"name":"John"}`}, bodies)
+}
+
+func TestHttpClient_RequestBuilderDefaults(t *testing.T) {
+	client, doer, done := newClient(t, WithBaseURL("https://api.example.com"))
+	defer done()
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, http.MethodGet, req.Method)
+		assert.Equal(t, "https://api.example.com/health", req.URL.String())
+		return &http.Response{StatusCode: 200}, nil
+	})
+	_, err := client.Request().Path("health").Do()
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "text/plain", req.Header.Get("Content-Type"))
+		return &http.Response{StatusCode: 200}, nil
+	})
+	_, err = client.Request().Method(http.MethodPut).Header("Content-Type", "text/plain").Body(strings.NewReader("x")).Do()
+	assert.Nil(t, err)
+
+	_, err = client.Request().JSON(func() {}).Do()
+	var jsonErr *json.UnsupportedTypeError
+	assert.True(t, errors.As(err, &jsonErr))
+}
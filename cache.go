@@ -0,0 +1,258 @@
+package httpclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CachedResponse is a response stored by a Cache.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Expires is when the entry stops being fresh. A stale entry with an
+	// ETag or Last-Modified header is revalidated with the server.
+	Expires time.Time
+	// Vary holds the request headers named by the Vary response header,
+	// as sent with the request that stored the entry. The entry is only
+	// served to requests carrying the same values.
+	Vary http.Header
+}
+
+// Cache stores responses keyed by the request method and URL.
+type Cache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, entry *CachedResponse, ttl time.Duration)
+}
+
+type memoryEntry struct {
+	entry   *CachedResponse
+	expires time.Time
+}
+
+// memorySweepInterval is how often Set drops the expired entries which
+// were never read again.
+const memorySweepInterval = time.Minute
+
+// memoryCache is a Cache keeping entries in memory until they expire.
+type memoryCache struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	now       func() time.Time
+	nextSweep time.Time
+}
+
+// NewMemoryCache returns a Cache keeping entries in memory for their TTL.
+// Expired entries are dropped when read and swept out regularly by Set.
+func NewMemoryCache() Cache {
+	return &memoryCache{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *memoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.entry, true
+}
+
+func (c *memoryCache) Set(key string, entry *CachedResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if !now.Before(c.nextSweep) {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(memorySweepInterval)
+	}
+	c.entries[key] = memoryEntry{entry: entry, expires: now.Add(ttl)}
+}
+
+// cacheKey identifies the request in the cache.
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+// isCacheableRequest reports whether the response to the request may be
+// served from or stored in the cache. Range requests are sent as is, a
+// partial response must never answer a plain GET.
+func isCacheableRequest(req *http.Request) bool {
+	return req.Method == http.MethodGet && len(req.Header.Get("Range")) == 0
+}
+
+// doCached serves GET requests from the cache and stores cacheable
+// responses of the requests it had to send. Stale entries are revalidated
+// with a conditional request and served again on 304 Not Modified.
+func (c *HttpClient) doCached(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+	header := req.Header.Clone()
+	entry, ok := c.cache.Get(key)
+	if ok && !entry.matches(header) {
+		ok = false
+	}
+	if ok && c.clock.Now().Before(entry.Expires) {
+		return entry.response(req), nil
+	}
+	sent := req
+	if ok {
+		sent = conditionalRequest(req, entry)
+	}
+	resp, err := c.do(sent)
+	if err != nil {
+		return resp, err
+	}
+	if sent != req && resp.StatusCode == http.StatusNotModified {
+		c.discardResponse(resp)
+		entry = entry.revalidated(resp.Header)
+		c.storeCache(key, entry)
+		return entry.response(req), nil
+	}
+	if !isCacheable(resp) {
+		return resp, nil
+	}
+	vary := varyHeader(header, resp.Header)
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return resp, errors.Wrap(err, "cache - read body failed")
+	}
+	entry = &CachedResponse{StatusCode: resp.StatusCode, Header: resp.Header.Clone(), Body: body, Vary: vary}
+	c.storeCache(key, entry)
+	return entry.response(req), nil
+}
+
+// storeCache stores the entry, fresh for the cache TTL. Entries which can
+// be revalidated are kept longer, for the revalidation window.
+func (c *HttpClient) storeCache(key string, entry *CachedResponse) {
+	entry.Expires = c.clock.Now().Add(c.cacheTTL)
+	ttl := c.cacheTTL
+	if entry.hasValidators() {
+		ttl += c.cacheRevalidate
+	}
+	c.cache.Set(key, entry, ttl)
+}
+
+// conditionalRequest returns a copy of the request asking the server to
+// answer 304 Not Modified if the entry is still current. The request is
+// returned as is when the entry has no validators or the caller already
+// made it conditional.
+func conditionalRequest(req *http.Request, entry *CachedResponse) *http.Request {
+	if !entry.hasValidators() ||
+		len(req.Header.Get("If-None-Match")) > 0 || len(req.Header.Get("If-Modified-Since")) > 0 {
+		return req
+	}
+	cond := req.Clone(req.Context())
+	if cond.Header == nil {
+		cond.Header = make(http.Header)
+	}
+	if etag := entry.Header.Get("ETag"); len(etag) > 0 {
+		cond.Header.Set("If-None-Match", etag)
+	}
+	if modified := entry.Header.Get("Last-Modified"); len(modified) > 0 {
+		cond.Header.Set("If-Modified-Since", modified)
+	}
+	return cond
+}
+
+func (e *CachedResponse) hasValidators() bool {
+	return len(e.Header.Get("ETag")) > 0 || len(e.Header.Get("Last-Modified")) > 0
+}
+
+// revalidated returns a copy of the entry with the headers of the 304
+// response merged in. Validators the server left out are kept.
+func (e *CachedResponse) revalidated(header http.Header) *CachedResponse {
+	updated := &CachedResponse{StatusCode: e.StatusCode, Header: e.Header.Clone(), Body: e.Body, Vary: e.Vary}
+	for key, values := range header {
+		if key == "Content-Length" {
+			continue
+		}
+		updated.Header[key] = append([]string(nil), values...)
+	}
+	return updated
+}
+
+// varyHeader returns the values of the request headers named by the Vary
+// response header, nil when the response doesn't vary.
+func varyHeader(reqHeader, respHeader http.Header) http.Header {
+	var vary http.Header
+	for _, value := range respHeader.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[http.CanonicalHeaderKey(name)] = append([]string(nil), reqHeader.Values(name)...)
+		}
+	}
+	return vary
+}
+
+// matches reports whether the request headers carry the values the entry
+// varies on.
+func (e *CachedResponse) matches(reqHeader http.Header) bool {
+	for name, values := range e.Vary {
+		if strings.Join(values, ",") != strings.Join(reqHeader.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// isCacheable reports whether the response may be stored: a 200 OK
+// response with a body, without Cache-Control: no-store and not varying
+// on every request with Vary: *.
+func isCacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || resp.Body == nil {
+		return false
+	}
+	for _, value := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if strings.TrimSpace(name) == "*" {
+				return false
+			}
+		}
+	}
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return false
+		}
+	}
+	return true
+}
+
+// response builds a response with its own copy of the cached body.
+func (e *CachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
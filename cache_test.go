@@ -0,0 +1,277 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_ResponseCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := NewMemoryCache().(*memoryCache)
+	cache.now = func() time.Time { return now }
+	client, doer, done := newClient(t, WithResponseCache(cache, time.Minute))
+	defer done()
+
+	get := func() string {
+		resp, err := client.Get(context.Background(), "https://google.com/config", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, resp.Body.Close())
+		return string(body)
+	}
+	respond := func(body string) {
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		}, nil)
+	}
+
+	respond(`{"v":1}`)
+	assert.Equal(t, `{"v":1}`, get())
+	// served from the cache with a fresh body
+	assert.Equal(t, `{"v":1}`, get())
+	assert.Equal(t, `{"v":1}`, get())
+
+	// expired
+	now = now.Add(time.Minute)
+	respond(`{"v":2}`)
+	assert.Equal(t, `{"v":2}`, get())
+	assert.Equal(t, `{"v":2}`, get())
+}
+
+func TestHttpClient_ResponseCacheSkipped(t *testing.T) {
+	client, doer, done := newClient(t, WithResponseCache(NewMemoryCache(), time.Minute))
+	defer done()
+
+	// no-store responses
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Cache-Control": {"private, no-store"}},
+		Body:       http.NoBody,
+	}, nil)
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(context.Background(), "https://google.com/a", nil)
+		assert.Nil(t, err)
+	}
+
+	// unsuccessful responses
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 404, Body: http.NoBody}, nil)
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(context.Background(), "https://google.com/b", nil)
+		assert.Nil(t, err)
+	}
+
+	// other methods
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil)
+	for i := 0; i < 2; i++ {
+		_, err := client.Post(context.Background(), "https://google.com/c", nil, nil)
+		assert.Nil(t, err)
+	}
+}
+
+func TestHttpClient_ResponseCacheRevalidation(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	cache := NewMemoryCache().(*memoryCache)
+	cache.now = clk.Now
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithResponseCache(cache, time.Minute),
+		WithResponseCacheRevalidation(time.Hour),
+	)
+	defer done()
+
+	get := func() *http.Response {
+		resp, err := client.Get(context.Background(), "https://google.com/config", nil)
+		assert.Nil(t, err)
+		return resp
+	}
+	readBody := func(resp *http.Response) string {
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Etag": {`"v1"`}, "X-Version": {"1"}},
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("payload v1"))),
+	}, nil).Do(func(req *http.Request) {
+		assert.Empty(t, req.Header.Get("If-None-Match"))
+	})
+	assert.Equal(t, "payload v1", readBody(get()))
+
+	// stale, the server answers 304 without repeating the ETag
+	clk.now = clk.now.Add(2 * time.Minute)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: http.StatusNotModified,
+		Header:     http.Header{"X-Version": {"2"}},
+		Body:       http.NoBody,
+	}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, `"v1"`, req.Header.Get("If-None-Match"))
+	})
+	resp := get()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "payload v1", readBody(resp))
+	assert.Equal(t, "2", resp.Header.Get("X-Version"))
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+
+	// fresh again after the revalidation
+	assert.Equal(t, "payload v1", readBody(get()))
+
+	// the content changed and the server dropped the ETag
+	clk.now = clk.now.Add(2 * time.Minute)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("payload v2"))),
+	}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, `"v1"`, req.Header.Get("If-None-Match"))
+	})
+	assert.Equal(t, "payload v2", readBody(get()))
+
+	// without validators the entry is dropped once it expires
+	clk.now = clk.now.Add(2 * time.Minute)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("payload v3"))),
+	}, nil).Do(func(req *http.Request) {
+		assert.Empty(t, req.Header.Get("If-None-Match"))
+	})
+	assert.Equal(t, "payload v3", readBody(get()))
+}
+
+func TestHttpClient_GetResultCache(t *testing.T) {
+	client, doer, done := newClient(t, WithGetResultCache(time.Minute))
+	defer done()
+
+	payload := bytes.Repeat([]byte(`{"v":1}`), 1000)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader(payload)),
+	}, nil)
+	first, err := client.Get(context.Background(), "https://google.com/config", nil)
+	assert.Nil(t, err)
+	second, err := client.Get(context.Background(), "https://google.com/config", nil)
+	assert.Nil(t, err)
+	for _, resp := range []*http.Response{first, second} {
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, body)
+		assert.Nil(t, resp.Body.Close())
+	}
+
+	// other URLs are fetched
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil)
+	_, err = client.Get(context.Background(), "https://google.com/other", nil)
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_ResponseCacheRange(t *testing.T) {
+	client, doer, done := newClient(t, WithResponseCache(NewMemoryCache(), time.Minute))
+	defer done()
+
+	// range requests bypass the cache
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{
+		StatusCode: http.StatusPartialContent,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("ab"))),
+	}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "bytes=0-1", req.Header.Get("Range"))
+	})
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(context.Background(), "https://google.com/file", http.Header{"Range": {"bytes=0-1"}})
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	}
+
+	// a partial response to a plain GET isn't stored either
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: http.StatusPartialContent,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("ab"))),
+	}, nil)
+	resp, err := client.Get(context.Background(), "https://google.com/file", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte("abcdef"))),
+	}, nil)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(context.Background(), "https://google.com/file", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "abcdef", string(body))
+	}
+}
+
+func TestHttpClient_ResponseCacheVary(t *testing.T) {
+	client, doer, done := newClient(t, WithResponseCache(NewMemoryCache(), time.Minute))
+	defer done()
+
+	get := func(lang string) string {
+		resp, err := client.Get(context.Background(), "https://google.com/page", http.Header{"Accept-Language": {lang}})
+		assert.Nil(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(body)
+	}
+	respond := func(vary, body string) {
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Vary": {vary}},
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(body))),
+		}, nil)
+	}
+
+	respond("Accept-Encoding, Accept-Language", "hello")
+	assert.Equal(t, "hello", get("en"))
+	assert.Equal(t, "hello", get("en"))
+
+	// another variant replaces the stored one
+	respond("Accept-Encoding, Accept-Language", "bonjour")
+	assert.Equal(t, "bonjour", get("fr"))
+	assert.Equal(t, "bonjour", get("fr"))
+
+	// Vary: * is never stored
+	respond("*", "hallo")
+	respond("*", "hallo")
+	resp, err := client.Get(context.Background(), "https://google.com/other", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	resp, err = client.Get(context.Background(), "https://google.com/other", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+}
+
+func TestMemoryCache_Sweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := NewMemoryCache().(*memoryCache)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", &CachedResponse{}, time.Second)
+	cache.Set("b", &CachedResponse{}, time.Hour)
+	assert.Len(t, cache.entries, 2)
+
+	// expired entries which are never read again are dropped by a later Set
+	now = now.Add(memorySweepInterval)
+	cache.Set("c", &CachedResponse{}, time.Second)
+	assert.Len(t, cache.entries, 2)
+	_, ok := cache.entries["a"]
+	assert.False(t, ok)
+
+	// not before the next sweep
+	now = now.Add(time.Second)
+	cache.Set("d", &CachedResponse{}, time.Second)
+	assert.Len(t, cache.entries, 3)
+}
@@ -0,0 +1,38 @@
+package httpclient
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// decodeCharset replaces a body declared in a charset other than UTF-8 by
+// the Content-Type header with a reader transcoding it to UTF-8. Bodies in
+// unknown charsets are left untouched.
+func decodeCharset(resp *http.Response) {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || len(params["charset"]) == 0 {
+		return
+	}
+	enc, err := htmlindex.Get(params["charset"])
+	if err != nil {
+		return
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{transform.NewReader(resp.Body, enc.NewDecoder()), resp.Body}
+	params["charset"] = "utf-8"
+	resp.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+}
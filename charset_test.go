@@ -0,0 +1,46 @@
+package httpclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_CharsetDecoding(t *testing.T) {
+	client, doer, done := newClient(t, WithCharsetDecoding())
+	defer done()
+
+	for contentType, want := range map[string]struct {
+		body        string
+		contentType string
+	}{
+		"text/plain; charset=ISO-8859-1": {"café crème", "text/plain; charset=utf-8"},
+		"text/plain; charset=utf-8":      {"caf\xe9 cr\xe8me", "text/plain; charset=utf-8"},
+		"text/plain":                     {"caf\xe9 cr\xe8me", "text/plain"},
+		"text/plain; charset=unknown":    {"caf\xe9 cr\xe8me", "text/plain; charset=unknown"},
+	} {
+		header := make(http.Header)
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Length", "10")
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+			StatusCode:    200,
+			Header:        header,
+			ContentLength: 10,
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte("caf\xe9 cr\xe8me"))),
+		}, nil)
+		req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+		assert.Nil(t, err)
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, resp.Body.Close())
+		assert.Equal(t, want.body, string(body), contentType)
+		assert.Equal(t, want.contentType, resp.Header.Get("Content-Type"), contentType)
+	}
+}
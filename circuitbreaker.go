@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker rejects a request.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker decides whether a request may be dispatched to an upstream.
+// Allow is called right before each attempt is dispatched and Record after
+// it, reporting whether the attempt succeeded. Every allowed attempt is
+// recorded.
+type CircuitBreaker interface {
+	Allow() bool
+	Record(success bool)
+}
+
+// consecutiveBreaker is a circuit breaker which opens after a number of
+// consecutive failures and lets a single probe request through once the
+// cooldown has passed.
+type consecutiveBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// NewCircuitBreaker returns a circuit breaker which opens after threshold
+// consecutive failures and stays open for the cooldown duration.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &consecutiveBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+func (b *consecutiveBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *consecutiveBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// hostBreakers keeps an independent circuit breaker per target host.
+type hostBreakers struct {
+	mu       sync.Mutex
+	factory  func() CircuitBreaker
+	breakers map[string]CircuitBreaker
+}
+
+func newHostBreakers(factory func() CircuitBreaker) *hostBreakers {
+	return &hostBreakers{
+		factory:  factory,
+		breakers: make(map[string]CircuitBreaker),
+	}
+}
+
+func (h *hostBreakers) get(host string) CircuitBreaker {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cb, ok := h.breakers[host]
+	if !ok {
+		cb = h.factory()
+		h.breakers[host] = cb
+	}
+	return cb
+}
+
+// circuitBreaker returns the circuit breaker guarding the request or nil.
+func (c *HttpClient) circuitBreaker(req *http.Request) CircuitBreaker {
+	if c.hostBreakers != nil {
+		return c.hostBreakers.get(req.URL.Host)
+	}
+	return c.breaker
+}
+
+func isAttemptSuccess(resp *http.Response, err error) bool {
+	return err == nil && resp != nil && resp.StatusCode < http.StatusInternalServerError
+}
@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingBreaker struct {
+	threshold int
+	failures  int
+}
+
+func (b *countingBreaker) Allow() bool {
+	return b.failures < b.threshold
+}
+
+func (b *countingBreaker) Record(success bool) {
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+}
+
+func TestHttpClient_PerHostCircuitBreaker(t *testing.T) {
+	client, doer, done := newClient(t, WithPerHostCircuitBreaker(func() CircuitBreaker {
+		return &countingBreaker{threshold: 2}
+	}))
+	defer done()
+	ctx := context.TODO()
+
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(nil, someErr).Do(func(req *http.Request) {
+		assert.Equal(t, "a.com", req.URL.Host)
+	})
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(ctx, "http://a.com/path", nil)
+		assert.EqualError(t, err, someErr.Error())
+	}
+
+	// host A is open, the doer isn't called
+	resp, err := client.Get(ctx, "http://a.com/path", nil)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Nil(t, resp)
+
+	// host B is healthy
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "b.com", req.URL.Host)
+	})
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ctx, "http://b.com/path", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestHttpClient_CircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(3, time.Minute)
+	breaker.(*consecutiveBreaker).now = func() time.Time { return now }
+	client, doer, done := newClient(t, WithCircuitBreaker(breaker))
+	defer done()
+	ctx := context.TODO()
+
+	// trips after 3 failures
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 503}, nil)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ctx, "http://a.com/path", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	// the doer isn't touched while open
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(ctx, "http://b.com/path", nil)
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+		assert.Nil(t, resp)
+	}
+
+	// a single probe is let through after the cooldown
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+	assert.False(t, breaker.Allow())
+	breaker.Record(true)
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil)
+	resp, err := client.Get(ctx, "http://a.com/path", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCircuitBreaker_FailedProbe(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Second)
+	breaker.(*consecutiveBreaker).now = func() time.Time { return now }
+
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	assert.False(t, breaker.Allow())
+
+	now = now.Add(time.Second)
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	assert.False(t, breaker.Allow())
+}
+
+func TestHttpClient_CircuitBreakerHalfOpenAbortedAttempt(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.(*consecutiveBreaker).now = func() time.Time { return now }
+	tokenErr := errors.New("token endpoint down")
+	failToken := true
+	client, doer, done := newClient(t,
+		WithCircuitBreaker(breaker),
+		WithTokenSource(TokenSourceFunc(func(ctx context.Context) (string, error) {
+			if failToken {
+				return "", tokenErr
+			}
+			return "token", nil
+		})),
+	)
+	defer done()
+	ctx := context.TODO()
+
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	now = now.Add(time.Minute)
+
+	// the attempt is aborted before dispatch, the breaker isn't consulted
+	resp, err := client.Get(ctx, "http://a.com/path", nil)
+	assert.True(t, errors.Is(err, tokenErr))
+	assert.Nil(t, resp)
+
+	// the probe is still available
+	failToken = false
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil)
+	resp, err = client.Get(ctx, "http://a.com/path", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
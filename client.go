@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -17,9 +18,22 @@ type Doer interface {
 type Client interface {
 	Get(ctx context.Context, url string, headers http.Header) (*http.Response, error)
 	Post(ctx context.Context, url string, body io.Reader, headers http.Header) (*http.Response, error)
+	PostForm(ctx context.Context, url string, form url.Values, headers http.Header) (*http.Response, error)
+	PostMultipart(ctx context.Context, url string, fields map[string]string, files map[string]io.Reader, headers http.Header) (*http.Response, error)
 	Put(ctx context.Context, url string, body io.Reader, headers http.Header) (*http.Response, error)
 	Delete(ctx context.Context, url string, headers http.Header) (*http.Response, error)
 	Do(req *http.Request) (*http.Response, error)
+	DoWithResult(req *http.Request) (*Result, error)
+	DoWithOptions(req *http.Request, opts ...RequestOption) (*http.Response, error)
+	Request() *RequestBuilder
+	GetRange(ctx context.Context, url string, start, end int64, headers http.Header) (*http.Response, error)
+	DownloadToFile(ctx context.Context, url, filePath string, headers http.Header) (int64, error)
+	Stream(ctx context.Context, url string, headers http.Header) (<-chan Event, error)
+	Download(ctx context.Context, url string, w io.Writer, headers http.Header, progress func(bytesWritten int64)) (int64, error)
+	DoUntil(ctx context.Context, req *http.Request, done func(*http.Response) (bool, error), interval time.Duration) (*http.Response, error)
+	LatencySummary() LatencySummary
+	With(opts ...Option) (Client, error)
+	WarmUp(ctx context.Context, n int) error
 }
 
 // RequestHook allows a function to run before each retry. The HTTP
@@ -49,11 +63,37 @@ type CheckRetry func(req *http.Request, resp *http.Response, err error) (bool, e
 // that should pass before trying again.
 type BackOff func(attemptNum int, resp *http.Response) time.Duration
 
+// BackOffHook is called right before each back off sleep with the wait
+// computed by the BackOff policy. The hook can observe the wait or
+// override it by assigning a different duration.
+type BackOffHook func(attemptNum int, resp *http.Response, wait *time.Duration)
+
 // ErrorHandler is called if retries are expired, containing the last status
 // from the http library. If not specified, default behavior for the library is
 // to close the body and return an error indicating how many tries were
 // attempted. If overriding this, be sure to close the body if needed.
 type ErrorHandler func(resp *http.Response, err error, numTries int) (*http.Response, error)
 
+// RequestErrorHandler is an ErrorHandler which also receives the request
+// and its context, e.g. to log with a trace ID or to pick a fallback by URL.
+type RequestErrorHandler func(ctx context.Context, req *http.Request, resp *http.Response, err error, numTries int) (*http.Response, error)
+
+// withRequest adapts the handler to a RequestErrorHandler.
+func (eh ErrorHandler) withRequest() RequestErrorHandler {
+	return func(ctx context.Context, req *http.Request, resp *http.Response, err error, numTries int) (*http.Response, error) {
+		return eh(resp, err, numTries)
+	}
+}
+
 // ErrorHook is called when the request returned a connection error.
 type ErrorHook func(req *http.Request, err error, retry int)
+
+// FailureHook is called for every failed attempt: either when the request
+// returned a connection error or when the response triggers a retry. The
+// response is nil for connection errors and err is nil for responses.
+type FailureHook func(req *http.Request, resp *http.Response, err error, retry int)
+
+// BodyReadHook is called once the caller has read the response body to
+// EOF or closed it, with the number of bytes read and the time elapsed
+// since the request was started.
+type BodyReadHook func(req *http.Request, bytesRead int64, d time.Duration)
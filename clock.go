@@ -0,0 +1,24 @@
+package httpclient
+
+import "time"
+
+// clock provides the time functions used between attempts so tests can
+// replace them.
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// withClock replaces the real clock.
+func withClock(clk clock) Option {
+	return func(c *HttpClient) {
+		c.clock = clk
+	}
+}
@@ -0,0 +1,118 @@
+package httpclient
+
+import (
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock advances instantly and records every wait.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Sleep(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestHttpClient_ClockBackOff(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration {
+			return 100 * time.Millisecond << uint(attemptNum)
+		}),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(req).Times(4).Return(&http.Response{StatusCode: 503}, nil)
+	start := time.Now()
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, clk.waits)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestHttpClient_ClockRetryBudget(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRetryCount(10),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 100 * time.Millisecond }),
+		WithRetryBudget(250*time.Millisecond),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(req).Times(3).Return(nil, someErr)
+	_, err = client.Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, clk.waits)
+}
+
+func TestHttpClient_ClockRetryWaits(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRetryCount(5),
+		WithRetryWaits([]time.Duration{time.Second, 5 * time.Second, time.Minute}),
+		WithMaxRetryWait(10*time.Second),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(gomock.Any()).Times(4).Return(&http.Response{StatusCode: 503}, nil)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, []time.Duration{time.Second, 5 * time.Second, 10 * time.Second}, clk.waits)
+}
+
+func TestHttpClient_BackoffCeilingRandomization(t *testing.T) {
+	cappedWait := func(seed int64) time.Duration {
+		clk := &fakeClock{now: time.Unix(0, 0)}
+		client, doer, done := newClient(t,
+			withClock(clk),
+			WithRetryCount(1),
+			WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return time.Hour }),
+			WithMaxRetryWait(time.Second),
+			WithBackoffCeilingRandomization(0.5),
+			WithRandSource(rand.NewSource(seed)),
+		)
+		defer done()
+		req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+		assert.Nil(t, err)
+		doer.EXPECT().Do(req).Times(2).Return(&http.Response{StatusCode: 503}, nil)
+		_, err = client.Do(req)
+		assert.True(t, errors.Is(err, ErrRetriesExhausted))
+		assert.Len(t, clk.waits, 1)
+		return clk.waits[0]
+	}
+
+	first, second := cappedWait(1), cappedWait(2)
+	assert.NotEqual(t, first, second)
+	for _, wait := range []time.Duration{first, second} {
+		assert.True(t, wait >= 500*time.Millisecond && wait <= time.Second, wait)
+	}
+	assert.Equal(t, first, cappedWait(1))
+}
@@ -0,0 +1,34 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// NewCookieJar returns an in-memory cookie jar to use with WithCookieJar.
+func NewCookieJar() (http.CookieJar, error) {
+	return cookiejar.New(nil)
+}
+
+// addCookies adds the jar cookies to a request dispatched by a custom Doer.
+func (c *HttpClient) addCookies(req *http.Request) {
+	if c.jar == nil || c.jarInClient {
+		return
+	}
+	for _, cookie := range c.jar.Cookies(req.URL) {
+		if _, err := req.Cookie(cookie.Name); err == nil {
+			continue
+		}
+		req.AddCookie(cookie)
+	}
+}
+
+// storeCookies saves the response cookies when a custom Doer is used.
+func (c *HttpClient) storeCookies(req *http.Request, resp *http.Response) {
+	if c.jar == nil || c.jarInClient || resp == nil {
+		return
+	}
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		c.jar.SetCookies(req.URL, cookies)
+	}
+}
@@ -0,0 +1,97 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// errBodyClosed is returned when reading a decompressed body after Close.
+var errBodyClosed = errors.New("read on closed response body")
+
+// gzipReaders pools the readers of decompressed bodies, reused with Reset.
+var gzipReaders sync.Pool
+
+// acquireGzipReader returns a pooled gzip reader reading from r.
+func acquireGzipReader(r io.Reader) (*gzip.Reader, error) {
+	zr, ok := gzipReaders.Get().(*gzip.Reader)
+	if !ok {
+		return gzip.NewReader(r)
+	}
+	if err := zr.Reset(r); err != nil {
+		gzipReaders.Put(zr)
+		return nil, err
+	}
+	return zr, nil
+}
+
+// gzipBody decompresses the wrapped body lazily on the first read.
+// Closing it closes the underlying body and releases the reader.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = acquireGzipReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	if b.err == errBodyClosed {
+		return nil
+	}
+	if b.zr != nil {
+		_ = b.zr.Close()
+		gzipReaders.Put(b.zr)
+		b.zr = nil
+	}
+	b.err = errBodyClosed
+	return b.body.Close()
+}
+
+// decompressResponse replaces a gzip encoded body with a decompressing one.
+func decompressResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	if !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), "gzip") {
+		return
+	}
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// compressRequestBody gzip compresses the buffered request body once so the
+// compressed bytes are replayed on retries. Empty bodies and bodies which
+// already have a content encoding are left untouched.
+func compressRequestBody(req *http.Request, data []byte) ([]byte, error) {
+	if len(data) == 0 || len(req.Header.Get("Content-Encoding")) > 0 {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, errors.Wrap(err, "compress - write body failed")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.Wrap(err, "compress - close writer failed")
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	req.ContentLength = int64(buf.Len())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,160 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func gzipBytes(t *testing.T, payload []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(payload)
+	assert.Nil(t, err)
+	assert.Nil(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestHttpClient_AutoDecompress(t *testing.T) {
+	client, doer, done := newClient(t, WithAutoDecompress())
+	defer done()
+	payload := []byte(`{"test":"test"}`)
+	compressed := gzipBytes(t, payload)
+	body := newTrackingBody(compressed)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	doer.EXPECT().Do(req).Times(1).Return(&http.Response{
+		StatusCode:    200,
+		ContentLength: int64(len(compressed)),
+		Header: http.Header{
+			"Content-Encoding": {"gzip"},
+			"Content-Length":   {"42"},
+			"Content-Type":     {"application/json"},
+		},
+		Body: body,
+	}, nil)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Empty(t, resp.Header.Get("Content-Length"))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, int64(-1), resp.ContentLength)
+	assert.True(t, resp.Uncompressed)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, 1, body.closed)
+
+	// plain bodies are left untouched
+	plain := newTrackingBody(payload)
+	doer.EXPECT().Do(req).Times(1).Return(&http.Response{StatusCode: 200, Header: http.Header{}, Body: plain}, nil)
+	resp, err = client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, resp.Body)
+}
+
+func TestHttpClient_RequestCompression(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRequestCompression(),
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+	payload := bytes.Repeat([]byte(`{"test":"test"}`), 100)
+	check := func(req *http.Request) {
+		assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+		compressed, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(compressed)), req.ContentLength)
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		assert.Nil(t, err)
+		b, err := ioutil.ReadAll(zr)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, b)
+	}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500}, nil).Do(check),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(check),
+	)
+	_, err := client.Put(context.TODO(), "http://test.com", bytes.NewReader(payload), nil)
+	assert.Nil(t, err)
+
+	// empty bodies are not compressed
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Empty(t, req.Header.Get("Content-Encoding"))
+	})
+	_, err = client.Post(context.TODO(), "http://test.com", bytes.NewReader(nil), nil)
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_AutoDecompressConcurrent(t *testing.T) {
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Encoding": {"gzip"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(gzipBytes(t, []byte(req.URL.Path)))),
+		}, nil
+	})
+	cli, err := New(WithDoer(doer), WithAutoDecompress())
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				path := "/payload/" + strconv.Itoa(i) + "/" + strconv.Itoa(j)
+				resp, err := cli.Get(context.Background(), "https://google.com"+path, nil)
+				assert.Nil(t, err)
+				b, err := ioutil.ReadAll(resp.Body)
+				assert.Nil(t, err)
+				assert.Nil(t, resp.Body.Close())
+				assert.Equal(t, path, string(b))
+				_, err = resp.Body.Read(make([]byte, 1))
+				assert.Equal(t, errBodyClosed, err)
+				assert.Nil(t, resp.Body.Close())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkGzipBody(b *testing.B) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(bytes.Repeat([]byte(`{"test":"test"}`), 100))
+	_ = zw.Close()
+	compressed := buf.Bytes()
+
+	b.Run("new reader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			zr, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				b.Fatal(err)
+			}
+			_, _ = io.Copy(ioutil.Discard, zr)
+			_ = zr.Close()
+		}
+	})
+	b.Run("pooled reader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body := &gzipBody{body: ioutil.NopCloser(bytes.NewReader(compressed))}
+			_, _ = io.Copy(ioutil.Discard, body)
+			_ = body.Close()
+		}
+	})
+}
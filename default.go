@@ -0,0 +1,62 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var (
+	defaultMu     sync.RWMutex
+	defaultClient Client
+)
+
+// Default returns the client used by the package level functions. It is
+// created with New on first use unless set with SetDefault.
+func Default() Client {
+	defaultMu.RLock()
+	cli := defaultClient
+	defaultMu.RUnlock()
+	if cli != nil {
+		return cli
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultClient == nil {
+		cli, err := New()
+		if err != nil {
+			panic(err)
+		}
+		defaultClient = cli
+	}
+	return defaultClient
+}
+
+// SetDefault replaces the client used by the package level functions.
+// A nil client restores the lazily created one.
+func SetDefault(c Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = c
+}
+
+// Get makes a HTTP GET request with the default client.
+func Get(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	return Default().Get(ctx, url, headers)
+}
+
+// Post makes a HTTP POST request with the default client.
+func Post(ctx context.Context, url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	return Default().Post(ctx, url, body, headers)
+}
+
+// Put makes a HTTP PUT request with the default client.
+func Put(ctx context.Context, url string, body io.Reader, headers http.Header) (*http.Response, error) {
+	return Default().Put(ctx, url, body, headers)
+}
+
+// Delete makes a HTTP DELETE request with the default client.
+func Delete(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	return Default().Delete(ctx, url, headers)
+}
@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultClient(t *testing.T) {
+	defer SetDefault(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte(r.Method+" "), body...))
+	}))
+	defer server.Close()
+
+	// initialized once when used concurrently
+	var wg sync.WaitGroup
+	clients := make([]Client, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = Default()
+		}(i)
+	}
+	wg.Wait()
+	for _, cli := range clients {
+		assert.True(t, cli == clients[0])
+	}
+
+	read := func(resp *http.Response, err error) string {
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(b)
+	}
+	ctx := context.Background()
+	assert.Equal(t, "GET ", read(Get(ctx, server.URL, nil)))
+	assert.Equal(t, "POST a", read(Post(ctx, server.URL, bytes.NewReader([]byte("a")), nil)))
+	assert.Equal(t, "PUT b", read(Put(ctx, server.URL, bytes.NewReader([]byte("b")), nil)))
+	assert.Equal(t, "DELETE ", read(Delete(ctx, server.URL, nil)))
+
+	// swapped implementation
+	client, doer, done := newClient(t)
+	defer done()
+	SetDefault(client)
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: http.StatusTeapot}, nil)
+	resp, err := Get(ctx, server.URL, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+}
@@ -0,0 +1,80 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDigestMismatch is returned when the response body does not match
+// the Content-MD5 or Digest header sent by the server.
+var ErrDigestMismatch = errors.New("response body digest mismatch")
+
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":     md5.New,
+	"SHA":     sha1.New,
+	"SHA-256": sha256.New,
+	"SHA-512": sha512.New,
+}
+
+type contentDigest struct {
+	algorithm string
+	value     string
+}
+
+// verifyContentDigest reads the whole response body and checks it against
+// the Content-MD5 and Digest headers. The body is replaced with a reader
+// over the buffered bytes so the caller can still consume it.
+func verifyContentDigest(resp *http.Response) error {
+	digests := responseDigests(resp.Header)
+	if len(digests) == 0 || resp.Body == nil {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "digest - read body failed")
+	}
+	for _, d := range digests {
+		h := digestAlgorithms[d.algorithm]()
+		_, _ = h.Write(body)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != d.value {
+			return errors.Wrapf(ErrDigestMismatch, "%s", d.algorithm)
+		}
+	}
+	return nil
+}
+
+func responseDigests(header http.Header) []contentDigest {
+	var digests []contentDigest
+	if v := strings.TrimSpace(header.Get("Content-MD5")); v != "" {
+		digests = append(digests, contentDigest{algorithm: "MD5", value: v})
+	}
+	for _, line := range header.Values("Digest") {
+		for _, part := range strings.Split(line, ",") {
+			i := strings.Index(part, "=")
+			if i < 0 {
+				continue
+			}
+			algorithm := strings.ToUpper(strings.TrimSpace(part[:i]))
+			if _, ok := digestAlgorithms[algorithm]; !ok {
+				continue
+			}
+			digests = append(digests, contentDigest{
+				algorithm: algorithm,
+				value:     strings.TrimSpace(part[i+1:]),
+			})
+		}
+	}
+	return digests
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// downloadChunkSize is the size of the chunks Download streams.
+const downloadChunkSize = 32 * 1024
+
+// ErrRangeNotSatisfied is returned by GetRange when the server does not
+// answer with a partial content response.
+var ErrRangeNotSatisfied = errors.New("range request not satisfied")
+
+// GetRange makes a HTTP GET request for the bytes between start and end
+// inclusive, a negative end requests everything from start. The response
+// must have the 206 Partial Content status, otherwise it is returned along
+// with ErrRangeNotSatisfied.
+func (c *HttpClient) GetRange(ctx context.Context, url string, start, end int64, headers http.Header) (*http.Response, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	byteRange := "bytes=" + strconv.FormatInt(start, 10) + "-"
+	if end >= 0 {
+		byteRange += strconv.FormatInt(end, 10)
+	}
+	request.Header.Set("Range", byteRange)
+	resp, err := c.Do(request)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return resp, errors.Wrapf(ErrRangeNotSatisfied, "status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// DownloadToFile streams the body of a GET request to the file without
+// buffering it in memory and returns the number of bytes written. When the
+// file already exists the download is resumed with a Range request; a
+// server ignoring the range makes the file be rewritten from scratch.
+func (c *HttpClient) DownloadToFile(ctx context.Context, url, filePath string, headers http.Header) (int64, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, errors.Wrap(err, "download - open file failed")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "download - stat file failed")
+	}
+	offset := info.Size()
+
+	request, err := c.newRequest(ctx, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		if resp != nil && resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		return 0, nil
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return 0, errors.Wrap(err, "download - seek file failed")
+		}
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		if err := file.Truncate(0); err != nil {
+			return 0, errors.Wrap(err, "download - truncate file failed")
+		}
+	default:
+		return 0, errors.Errorf("download - unexpected status %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(file, resp.Body)
+	if err != nil {
+		return n, errors.Wrap(err, "download - write file failed")
+	}
+	return n, nil
+}
+
+// Download streams the body of a GET request to w in chunks and returns the
+// number of bytes written. progress, if not nil, is called after every
+// chunk with the total written so far. Retries only happen before the
+// response is returned by Do, so nothing is ever replayed into w.
+func (c *HttpClient) Download(ctx context.Context, url string, w io.Writer, headers http.Header, progress func(bytesWritten int64)) (int64, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		if resp != nil && resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, errors.Errorf("download - unexpected status %d", resp.StatusCode)
+	}
+
+	buf := make([]byte, downloadChunkSize)
+	var written int64
+	for {
+		if err := request.Context().Err(); err != nil {
+			return written, errors.Wrap(err, "download - canceled")
+		}
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			m, err := w.Write(buf[:n])
+			written += int64(m)
+			if err == nil && m < n {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, errors.Wrap(err, "download - write failed")
+			}
+			if progress != nil {
+				progress(written)
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, errors.Wrap(readErr, "download - read body failed")
+		}
+	}
+}
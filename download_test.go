@@ -0,0 +1,143 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_DownloadToFile(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "httpclient")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file.txt")
+
+	client, err := New()
+	assert.Nil(t, err)
+	n, err := client.DownloadToFile(context.TODO(), server.URL, path, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(b))
+
+	// resume a partial file
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content[:4000]), 0644))
+	n, err = client.DownloadToFile(context.TODO(), server.URL, path, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)-4000), n)
+	b, err = ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(b))
+
+	// complete file
+	n, err = client.DownloadToFile(context.TODO(), server.URL, path, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func TestHttpClient_GetRange(t *testing.T) {
+	content := "0123456789"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/norange" {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		assert.Equal(t, "bytes=2-5", r.Header.Get("Range"))
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL))
+	assert.Nil(t, err)
+	resp, err := client.GetRange(context.TODO(), "/", 2, 5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "2345", string(b))
+
+	resp, err = client.GetRange(context.TODO(), "/norange", 2, 5, nil)
+	assert.True(t, errors.Is(err, ErrRangeNotSatisfied))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHttpClient_Download(t *testing.T) {
+	content := strings.Repeat("0123456789", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	client, err := New()
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	var reports []int64
+	n, err := client.Download(context.TODO(), server.URL, &buf, nil, func(bytesWritten int64) {
+		reports = append(reports, bytesWritten)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Equal(t, content, buf.String())
+	assert.True(t, len(reports) > 1)
+	assert.Equal(t, int64(len(content)), reports[len(reports)-1])
+	for i := 1; i < len(reports); i++ {
+		assert.True(t, reports[i] > reports[i-1])
+	}
+}
+
+func TestHttpClient_DownloadCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := New()
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var buf bytes.Buffer
+	n, err := client.Download(ctx, server.URL, &buf, nil, func(bytesWritten int64) {
+		cancel()
+	})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int64(len("first chunk")), n)
+	assert.Equal(t, "first chunk", buf.String())
+}
+
+func TestHttpClient_DownloadUnexpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := New()
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	n, err := client.Download(context.TODO(), server.URL, &buf, nil, nil)
+	assert.EqualError(t, err, "download - unexpected status 404")
+	assert.Equal(t, int64(0), n)
+}
@@ -0,0 +1,96 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrRetriesExhausted is aggregated in the RetryError returned by Do when
+// the last response still calls for a retry but none is left, such as a
+// 503 Service Unavailable on the last attempt. The response is returned
+// along with the error and its body is still readable.
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryError is returned by Do when the request failed after all of its
+// attempts. It aggregates the errors of every attempt.
+type RetryError struct {
+	// Attempts is the number of attempts dispatched to the Doer.
+	Attempts int
+	// LastStatusCode is the status code of the last response, 0 if none.
+	LastStatusCode int
+	// Errors holds the errors in the order they occurred.
+	Errors []error
+}
+
+// retriesExhausted reports a response the retry policy would have retried.
+func retriesExhausted(resp *http.Response, attempts int) error {
+	return errors.Wrapf(ErrRetriesExhausted, "status %d after %d attempts", resp.StatusCode, attempts)
+}
+
+func (e *RetryError) push(err error) {
+	e.Errors = append(e.Errors, err)
+}
+
+// Error joins the messages of the aggregated errors.
+func (e *RetryError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Unwrap returns the last aggregated error.
+func (e *RetryError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+// UnexpectedStatusError is returned by Do when the final status code is
+// not one of those set with WithExpectStatus. The response is returned
+// along with it and its body is still readable.
+type UnexpectedStatusError struct {
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Body holds the first bytes of the response body.
+	Body []byte
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	msg := "unexpected status code " + strconv.Itoa(e.StatusCode)
+	if len(e.Body) > 0 {
+		msg += ": " + string(e.Body)
+	}
+	return msg
+}
+
+// DefaultRetryableError reports whether a request which failed with err is
+// worth retrying. It is used when no CheckRetry is set. Canceled contexts,
+// unknown hosts and invalid certificates are permanent, other errors such
+// as refused or reset connections and timeouts are deemed transient.
+func DefaultRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &invalidCert) || errors.As(err, &hostname) {
+		return false
+	}
+	return true
+}
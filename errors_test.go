@@ -0,0 +1,233 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_RetryError(t *testing.T) {
+	giveUpErr := errors.New("give up")
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+				return false, giveUpErr
+			}
+			return true, nil
+		}),
+	)
+	defer done()
+
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Times(2).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 503}, nil),
+	)
+	_, err = client.Do(req)
+
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 3, retryErr.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, retryErr.LastStatusCode)
+	assert.Equal(t, []error{someErr, someErr, giveUpErr}, retryErr.Errors)
+	assert.EqualError(t, err, "some error, some error, give up")
+	assert.True(t, errors.Is(err, giveUpErr))
+}
+
+func TestHttpClient_RetryErrorNoResponse(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(nil, someErr)
+	_, err = client.Do(req)
+
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 2, retryErr.Attempts)
+	assert.Equal(t, 0, retryErr.LastStatusCode)
+	assert.True(t, errors.Is(err, someErr))
+}
+
+func TestHttpClient_RetryErrorStatusExhausted(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	// the last response is returned along with a RetryError
+	doer.EXPECT().Do(gomock.Any()).Times(3).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	})
+	resp, err := client.Do(req)
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 3, retryErr.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, retryErr.LastStatusCode)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.EqualError(t, err, "status 503 after 3 attempts: retries exhausted")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// a client without retries returns the response as is
+	single, singleDoer, singleDone := newClient(t)
+	defer singleDone()
+	singleDoer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: http.StatusServiceUnavailable}, nil)
+	resp, err = single.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// an error of an earlier attempt is reported with the last status
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Times(2).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil
+		}),
+	)
+	resp, err = client.Do(req)
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 3, retryErr.Attempts)
+	assert.Equal(t, http.StatusBadGateway, retryErr.LastStatusCode)
+	assert.True(t, errors.Is(retryErr.Errors[0], someErr))
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestHttpClient_ExpectStatus(t *testing.T) {
+	client, doer, done := newClient(t, WithExpectStatus(http.StatusOK, http.StatusCreated))
+	defer done()
+
+	for _, code := range []int{http.StatusOK, http.StatusCreated} {
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+			StatusCode: code,
+			Body:       ioutil.NopCloser(strings.NewReader("ok")),
+		}, nil)
+		resp, err := client.Get(context.Background(), "https://google.com", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, code, resp.StatusCode)
+	}
+
+	body := strings.Repeat("x", 600)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	var statusErr *UnexpectedStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, body[:512], string(statusErr.Body))
+	assert.Equal(t, "unexpected status code 404: "+body[:512], err.Error())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(b))
+}
+
+func TestDefaultRetryableError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://google.com", Err: err}
+	}
+	for name, tc := range map[string]struct {
+		err       error
+		retryable bool
+	}{
+		"nil":                {err: nil, retryable: false},
+		"canceled":           {err: urlErr(context.Canceled), retryable: false},
+		"unknown host":       {err: urlErr(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}}), retryable: false},
+		"unknown authority":  {err: urlErr(x509.UnknownAuthorityError{}), retryable: false},
+		"expired cert":       {err: urlErr(x509.CertificateInvalidError{Reason: x509.Expired}), retryable: false},
+		"hostname mismatch":  {err: urlErr(x509.HostnameError{Host: "google.com"}), retryable: false},
+		"dns timeout":        {err: urlErr(&net.DNSError{Err: "i/o timeout", IsTimeout: true}), retryable: true},
+		"connection refused": {err: urlErr(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), retryable: true},
+		"connection reset":   {err: urlErr(&net.OpError{Op: "read", Err: syscall.ECONNRESET}), retryable: true},
+		"deadline exceeded":  {err: urlErr(context.DeadlineExceeded), retryable: true},
+		"unexpected eof":     {err: urlErr(io.ErrUnexpectedEOF), retryable: true},
+	} {
+		assert.Equal(t, tc.retryable, DefaultRetryableError(tc.err), name)
+	}
+}
+
+func TestHttpClient_NoRetryOnPermanentError(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	dnsErr := &url.Error{Op: "Get", URL: "https://nope.invalid", Err: &net.DNSError{IsNotFound: true}}
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(nil, dnsErr)
+	_, err := client.Get(context.Background(), "https://nope.invalid", nil)
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 1, retryErr.Attempts)
+	assert.Equal(t, []error{dnsErr}, retryErr.Errors)
+
+	// transient errors are retried
+	refused := &url.Error{Op: "Get", URL: "https://google.com", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(nil, refused),
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, 2, retryErr.Attempts)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestHttpClient_LastErrorOnly(t *testing.T) {
+	errs := []error{errors.New("refused"), errors.New("reset"), &url.Error{Op: "Get", URL: "https://google.com", Err: context.DeadlineExceeded}}
+	for _, lastOnly := range []bool{false, true} {
+		opts := []Option{
+			WithRetryCount(2),
+			WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		}
+		if lastOnly {
+			opts = append(opts, WithLastErrorOnly())
+		}
+		client, doer, done := newClient(t, opts...)
+		gomock.InOrder(
+			doer.EXPECT().Do(gomock.Any()).Return(nil, errs[0]),
+			doer.EXPECT().Do(gomock.Any()).Return(nil, errs[1]),
+			doer.EXPECT().Do(gomock.Any()).Return(nil, errs[2]),
+		)
+		_, err := client.Get(context.Background(), "https://google.com", nil)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		var urlErr *url.Error
+		assert.True(t, errors.As(err, &urlErr))
+		var retryErr *RetryError
+		if lastOnly {
+			assert.Equal(t, errs[2], err)
+			assert.Equal(t, `Get "https://google.com": context deadline exceeded`, err.Error())
+			assert.False(t, errors.As(err, &retryErr))
+		} else {
+			assert.Equal(t, `refused, reset, Get "https://google.com": context deadline exceeded`, err.Error())
+			assert.True(t, errors.As(err, &retryErr))
+			assert.Equal(t, errs, retryErr.Errors)
+		}
+		done()
+	}
+}
@@ -0,0 +1,81 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PostMultipart makes a HTTP POST request with a multipart/form-data body
+// made of the text fields and the files, keyed by form field name. A file
+// implementing Name() string, such as *os.File, keeps its base name as the
+// file name, other files are named after their field. The body is built in
+// memory so it can be replayed on retries.
+func (c *HttpClient) PostMultipart(ctx context.Context, url string, fields map[string]string, files map[string]io.Reader, headers http.Header) (*http.Response, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, name := range sortedKeys(fields) {
+		if err := w.WriteField(name, fields[name]); err != nil {
+			return nil, errors.Wrap(err, "multipart - write field failed")
+		}
+	}
+	fileNames := make([]string, 0, len(files))
+	for name := range files {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+	for _, name := range fileNames {
+		file := files[name]
+		fileName := name
+		if named, ok := file.(interface{ Name() string }); ok {
+			fileName = filepath.Base(named.Name())
+		}
+		part, err := w.CreateFormFile(name, fileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "multipart - create file part failed")
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			return nil, errors.Wrap(err, "multipart - write file failed")
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "multipart - close writer failed")
+	}
+	request, err := c.newRequest(ctx, http.MethodPost, url, &body, headers)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", w.FormDataContentType())
+	return c.Do(request)
+}
+
+// PostForm makes a HTTP POST request with the url-encoded form as body.
+// The Content-Type is set to application/x-www-form-urlencoded unless
+// headers already provide one.
+func (c *HttpClient) PostForm(ctx context.Context, url string, form url.Values, headers http.Header) (*http.Response, error) {
+	request, err := c.newRequest(ctx, http.MethodPost, url, strings.NewReader(form.Encode()), headers)
+	if err != nil {
+		return nil, err
+	}
+	if request.Header.Get("Content-Type") == "" {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return c.Do(request)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_PostMultipart(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithRetryableMethods(http.MethodPost),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	file, err := ioutil.TempFile("", "report-*.csv")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("a,b\n1,2\n")
+	assert.Nil(t, err)
+	_, err = file.Seek(0, io.SeekStart)
+	assert.Nil(t, err)
+	defer file.Close()
+
+	type part struct {
+		fileName string
+		content  string
+	}
+	parse := func(req *http.Request) map[string]part {
+		assert.Equal(t, "value", req.Header.Get("X-Header"))
+		mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		assert.Nil(t, err)
+		assert.Equal(t, "multipart/form-data", mediaType)
+		parts := make(map[string]part)
+		r := multipart.NewReader(req.Body, params["boundary"])
+		for {
+			p, err := r.NextPart()
+			if err == io.EOF {
+				break
+			}
+			assert.Nil(t, err)
+			b, err := ioutil.ReadAll(p)
+			assert.Nil(t, err)
+			parts[p.FormName()] = part{fileName: p.FileName(), content: string(b)}
+		}
+		return parts
+	}
+	want := map[string]part{
+		"title":  {content: "monthly"},
+		"owner":  {content: "ops"},
+		"report": {fileName: filepath.Base(file.Name()), content: "a,b\n1,2\n"},
+		"notes":  {fileName: "notes", content: "none"},
+	}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, want, parse(req))
+			return &http.Response{StatusCode: 503}, nil
+		}),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, want, parse(req))
+			return &http.Response{StatusCode: 201}, nil
+		}),
+	)
+
+	headers := http.Header{"X-Header": {"value"}}
+	resp, err := client.PostMultipart(context.TODO(), "https://google.com/upload",
+		map[string]string{"title": "monthly", "owner": "ops"},
+		map[string]io.Reader{"report": file, "notes": strings.NewReader("none")},
+		headers,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+}
+
+func TestHttpClient_PostForm(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithRetryableMethods(http.MethodPost),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	var bodies, contentTypes []string
+	record := func(req *http.Request) {
+		b, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		bodies = append(bodies, string(b))
+		contentTypes = append(contentTypes, req.Header.Get("Content-Type"))
+	}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			record(req)
+			return &http.Response{StatusCode: 503}, nil
+		}),
+		doer.EXPECT().Do(gomock.Any()).Times(3).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			record(req)
+			return &http.Response{StatusCode: 200}, nil
+		}),
+	)
+
+	form := url.Values{"name": {"John Doe"}, "tags": {"a", "b&c"}}
+	_, err := client.PostForm(context.TODO(), "https://google.com/form", form, nil)
+	assert.Nil(t, err)
+	_, err = client.PostForm(context.TODO(), "https://google.com/form", url.Values{}, nil)
+	assert.Nil(t, err)
+	_, err = client.PostForm(context.TODO(), "https://google.com/form", form, http.Header{"Content-Type": {"text/plain"}})
+	assert.Nil(t, err)
+
+	encoded := "name=John+Doe&tags=a&tags=b%26c"
+	assert.Equal(t, []string{encoded, encoded, "", encoded}, bodies)
+	assert.Equal(t, []string{
+		"application/x-www-form-urlencoded",
+		"application/x-www-form-urlencoded",
+		"application/x-www-form-urlencoded",
+		"text/plain",
+	}, contentTypes)
+}
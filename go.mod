@@ -3,8 +3,8 @@ module github.com/mediabuyerbot/httpclient
 go 1.14
 
 require (
-	github.com/gojek/valkyrie v0.0.0-20190210220504-8f62c1e7ba45
 	github.com/golang/mock v1.4.1
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.5.1
+	golang.org/x/text v0.3.3
 )
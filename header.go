@@ -0,0 +1,45 @@
+package httpclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderStrategy defines how duplicated header values are collapsed.
+type HeaderStrategy int
+
+const (
+	// HeaderFirstWins keeps the first value only.
+	HeaderFirstWins HeaderStrategy = iota
+	// HeaderLastWins keeps the last value only.
+	HeaderLastWins
+	// HeaderJoin joins all values into a single comma separated value.
+	HeaderJoin
+)
+
+// NormalizeHeader collapses the values of the named header to a single
+// value according to the strategy.
+func NormalizeHeader(h http.Header, name string, strategy HeaderStrategy) {
+	values := h.Values(name)
+	if len(values) < 2 {
+		return
+	}
+	switch strategy {
+	case HeaderFirstWins:
+		h.Set(name, values[0])
+	case HeaderLastWins:
+		h.Set(name, values[len(values)-1])
+	case HeaderJoin:
+		h.Set(name, strings.Join(values, ", "))
+	}
+}
+
+// normalizeResponseHeaders applies the configured strategies to the response.
+func (c *HttpClient) normalizeResponseHeaders(resp *http.Response) {
+	if resp == nil || resp.Header == nil {
+		return
+	}
+	for name, strategy := range c.headerStrategies {
+		NormalizeHeader(resp.Header, name, strategy)
+	}
+}
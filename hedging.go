@@ -0,0 +1,104 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// canHedge reports whether the request may be sent several times at once:
+// hedging is enabled, the method is idempotent and the body is replayable.
+func (c *HttpClient) canHedge(req *http.Request) bool {
+	if c.hedgeExtra <= 0 || !isReplayable(req) {
+		return false
+	}
+	for _, method := range idempotentMethods {
+		if req.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// hedge sends the request and, while no successful response came back, up
+// to hedgeExtra more copies spaced by hedgeDelay. The first successful
+// response wins and the other copies are canceled. A failed copy makes the
+// next one start right away, even while earlier copies are in flight; when
+// all of them fail the last failure is returned.
+func (c *HttpClient) hedge(doer Doer, req *http.Request) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+		idx  int
+	}
+	results := make(chan result, c.hedgeExtra+1)
+	var cancels []context.CancelFunc
+	launch := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		r := req.Clone(ctx)
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		if idx > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				results <- result{err: err, idx: idx}
+				return
+			}
+			r.Body = body
+		}
+		go func() {
+			resp, err := doer.Do(r)
+			results <- result{resp: resp, err: err, idx: idx}
+		}()
+	}
+
+	launch()
+	next := c.nextHedge(len(cancels))
+	var last *result
+	for pending := 1; pending > 0; {
+		select {
+		case <-next:
+			launch()
+			pending++
+			next = c.nextHedge(len(cancels))
+		case res := <-results:
+			pending--
+			if res.err == nil && res.resp.StatusCode < http.StatusInternalServerError {
+				for i, cancel := range cancels {
+					if i != res.idx {
+						cancel()
+					}
+				}
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						loser := <-results
+						c.discardResponse(loser.resp)
+					}
+				}(pending)
+				cancelWithBody(res.resp, cancels[res.idx])
+				return res.resp, nil
+			}
+			if last != nil {
+				c.discardResponse(last.resp)
+				cancels[last.idx]()
+			}
+			last = &res
+			if len(cancels) <= c.hedgeExtra {
+				launch()
+				pending++
+				next = c.nextHedge(len(cancels))
+			}
+		}
+	}
+	cancelWithBody(last.resp, cancels[last.idx])
+	return last.resp, last.err
+}
+
+// nextHedge returns a channel firing when the next copy is due, or nil
+// once all copies are launched.
+func (c *HttpClient) nextHedge(launched int) <-chan time.Time {
+	if launched > c.hedgeExtra {
+		return nil
+	}
+	return c.clock.After(c.hedgeDelay)
+}
@@ -0,0 +1,113 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_Hedging(t *testing.T) {
+	var calls int32
+	canceled := make(chan struct{})
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-req.Context().Done()
+			close(canceled)
+			return nil, req.Context().Err()
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader([]byte("fast")))}, nil
+	})
+	cli, err := New(WithDoer(doer), WithHedging(20*time.Millisecond, 2))
+	assert.Nil(t, err)
+
+	start := time.Now()
+	resp, err := cli.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, "fast", string(body))
+	assert.True(t, time.Since(start) < time.Second)
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("slow request was not canceled")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHttpClient_HedgingFailures(t *testing.T) {
+	var calls int32
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return &http.Response{StatusCode: 503, Body: http.NoBody}, nil
+	})
+	cli, err := New(WithDoer(doer), WithHedging(time.Hour, 2))
+	assert.Nil(t, err)
+
+	// failed copies start the next one right away
+	resp, err := cli.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// non idempotent methods are not hedged
+	atomic.StoreInt32(&calls, 0)
+	_, err = cli.Post(context.Background(), "https://google.com", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+// hedgeClock fires the first hedge delay at once and never the next ones.
+type hedgeClock struct {
+	fakeClock
+	fired bool
+}
+
+func (c *hedgeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	if !c.fired {
+		c.fired = true
+		ch <- c.now
+	}
+	return ch
+}
+
+func TestHttpClient_HedgingFailureWhileInFlight(t *testing.T) {
+	var calls int32
+	canceled := make(chan struct{})
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			<-req.Context().Done()
+			close(canceled)
+			return nil, req.Context().Err()
+		case 2:
+			return &http.Response{StatusCode: 503, Body: http.NoBody}, nil
+		default:
+			return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+		}
+	})
+	cli, err := New(WithDoer(doer), withClock(&hedgeClock{}), WithHedging(time.Hour, 2))
+	assert.Nil(t, err)
+
+	// the fast failure starts the last copy while the slow one is in flight
+	resp, err := cli.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("slow request was not canceled")
+	}
+}
@@ -5,11 +5,14 @@ import (
 	"context"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/gojek/valkyrie"
-
 	"github.com/pkg/errors"
 )
 
@@ -17,18 +20,146 @@ const (
 	DefaultHTTPTimeout = 60 * time.Second
 )
 
+// ErrInvalidOption is returned by New when the options produce an invalid
+// configuration.
+var ErrInvalidOption = errors.New("invalid option")
+
+// ErrBodyNotReplayable is returned when a retry is needed but the request
+// body can't be sent again, see WithRetryOnlyIfBodyReplayable.
+var ErrBodyNotReplayable = errors.New("request body is not replayable")
+
+// ErrRequestBodyTooLarge is returned when the request body exceeds
+// the limit set by WithMaxRequestBodySize.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
 // HttpClient is the http client implementation
 type HttpClient struct {
-	baseURL      string
-	client       Doer
-	retryCount   int
-	requestHook  RequestHook
-	responseHook ResponseHook
-	errorHook    ErrorHook
-	checkRetry   CheckRetry
-	backOff      BackOff
-	errorHandler ErrorHandler
-	timeouts     time.Duration
+	baseURL        string
+	escapePath     bool
+	client         Doer
+	retryCount     int
+	requestHooks   []RequestHook
+	responseHooks  []ResponseHook
+	errorHooks     []ErrorHook
+	failureHook    FailureHook
+	bodyReadHook   BodyReadHook
+	onSuccess      func(*http.Request, *http.Response)
+	onStatusChange func(from, to int, attempt int)
+	recoverHooks   bool
+	panicHandler   PanicHandler
+	checkRetry     CheckRetry
+	backOff        BackOff
+	backOffHook    BackOffHook
+	retryWaits     []time.Duration
+	retryBudget    time.Duration
+	maxRetryWait   time.Duration
+	ceilingBand    float64
+	rand           *lockedRand
+	probePath      string
+	probeTimeout   time.Duration
+	hedgeDelay     time.Duration
+	hedgeExtra     int
+	clock          clock
+	observableDoer bool
+	timeoutHeader  string
+
+	attemptContext func(ctx context.Context, attempt int) context.Context
+	attemptTimeout time.Duration
+	shutdownGrace  time.Duration
+
+	cacheRevalidate time.Duration
+
+	retryableMethods map[string]bool
+	retryStatusCodes map[int]bool
+	errorHandler     RequestErrorHandler
+	timeouts         time.Duration
+
+	defaultHeaders http.Header
+	hostHeaders    map[string]http.Header
+	verifyDigest   bool
+	validators     []func(*http.Response) error
+	expectStatus   map[int]bool
+	cache          Cache
+	cacheTTL       time.Duration
+	authorization  string
+	userAgent      string
+	accept         string
+	keepRetryBody  bool
+	finalRespHook  bool
+	asyncRespHook  bool
+	budgetHeader   string
+
+	retryIncomplete bool
+	retryEmptyBody  bool
+	autoDecompress  bool
+	compressRequest bool
+	decodeCharset   bool
+	noBodyBuffering bool
+
+	requireReplayable bool
+
+	maxRequestBody  int64
+	maxResponseBody int64
+
+	headerStrategies map[string]HeaderStrategy
+
+	transport        http.RoundTripper
+	ownTransport     *http.Transport
+	ownTLS           bool
+	dialTimeout      time.Duration
+	unixSocket       string
+	forceClose       bool
+	streamReconnect  bool
+	lastErrorOnly    bool
+	captureMax       int64
+	captureSink      func(body []byte)
+	hostDialTimeouts map[string]time.Duration
+	jar              http.CookieJar
+	jarInClient      bool
+	checkRedirect    func(req *http.Request, via []*http.Request) error
+	breaker          CircuitBreaker
+	hostBreakers     *hostBreakers
+	limiter          RateLimiter
+	metrics          MetricsCollector
+	latency          *latencyReservoir
+	tracer           Tracer
+	logger           Logger
+
+	logAllowedHeaders map[string]bool
+
+	sequenceHeader  string
+	requestIDHeader string
+	requestID       func(ctx context.Context) string
+	signer          Signer
+	tokenSource     TokenSource
+	sequence        *uint64
+
+	middlewares []Middleware
+	schemeDoers map[string]Doer
+
+	// opts are the options the client was built with, see With.
+	opts []Option
+
+	// err holds the first configuration error reported by an option.
+	err error
+}
+
+// idempotentMethods are retried by the default retry policy.
+var idempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPut,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[strings.ToUpper(m)] = true
+	}
+	return set
 }
 
 var defaultBackOffPolicy = func(attemptNum int, resp *http.Response) time.Duration {
@@ -38,150 +169,388 @@ var defaultBackOffPolicy = func(attemptNum int, resp *http.Response) time.Durati
 // New returns a new instance of Client.
 func New(opts ...Option) (Client, error) {
 	client := HttpClient{
-		backOff: defaultBackOffPolicy,
-		client: &http.Client{
-			Timeout: DefaultHTTPTimeout,
-		},
+		backOff:          defaultBackOffPolicy,
+		clock:            realClock{},
+		dialTimeout:      DefaultDialTimeout,
+		retryableMethods: methodSet(idempotentMethods),
 	}
 	for _, opt := range opts {
 		opt(&client)
 	}
-	cli, ok := client.client.(*http.Client)
-	if ok {
+	client.opts = append([]Option(nil), opts...)
+	if client.err != nil {
+		return nil, client.err
+	}
+	if err := client.validate(); err != nil {
+		return nil, err
+	}
+	if client.rand == nil {
+		client.rand = newLockedRand(rand.NewSource(time.Now().UnixNano()))
+	}
+	if client.client == nil {
+		client.client = &http.Client{
+			Timeout:       DefaultHTTPTimeout,
+			Transport:     client.transport,
+			Jar:           client.jar,
+			CheckRedirect: client.checkRedirect,
+		}
+		client.jarInClient = true
+	}
+	if cli, ok := client.client.(*http.Client); ok {
+		if !client.jarInClient {
+			// a caller supplied client may be shared, it is left untouched
+			copied := *cli
+			cli = &copied
+			client.client = cli
+		}
 		cli.Timeout = client.timeouts
 	}
+	if client.observableDoer {
+		client.client = client.observeDoer(client.client)
+		for scheme, doer := range client.schemeDoers {
+			client.schemeDoers[scheme] = client.observeDoer(doer)
+		}
+	}
+	client.client = chain(client.client, client.middlewares)
+	for scheme, doer := range client.schemeDoers {
+		client.schemeDoers[scheme] = chain(doer, client.middlewares)
+	}
 	return &client, nil
 }
 
+// With returns a new client built with the options of this client followed
+// by opts. The clients don't share any configuration state, only the values
+// passed to the options: a Doer, a CircuitBreaker, a Cache, a RateLimiter,
+// a CookieJar and the source set with WithRandSource, which is guarded by a
+// single lock. A *http.Client passed to WithDoer is copied by every client
+// and never modified.
+func (c *HttpClient) With(opts ...Option) (Client, error) {
+	return New(append(append([]Option(nil), c.opts...), opts...)...)
+}
+
+// validate rejects configuration the options can't express sensibly.
+func (c *HttpClient) validate() error {
+	switch {
+	case c.retryCount < 0:
+		return errors.Wrapf(ErrInvalidOption, "retry count %d", c.retryCount)
+	case c.timeouts < 0:
+		return errors.Wrapf(ErrInvalidOption, "timeout %s", c.timeouts)
+	case c.dialTimeout < 0:
+		return errors.Wrapf(ErrInvalidOption, "dial timeout %s", c.dialTimeout)
+	case c.retryBudget < 0:
+		return errors.Wrapf(ErrInvalidOption, "retry budget %s", c.retryBudget)
+	case c.attemptTimeout < 0:
+		return errors.Wrapf(ErrInvalidOption, "per attempt timeout %s", c.attemptTimeout)
+	case c.ceilingBand < 0 || c.ceilingBand > 1:
+		return errors.Wrapf(ErrInvalidOption, "back off ceiling band %g", c.ceilingBand)
+	case c.latency != nil && len(c.latency.samples) == 0:
+		return errors.Wrap(ErrInvalidOption, "latency tracking without samples")
+	case c.maxRetryWait < 0:
+		return errors.Wrapf(ErrInvalidOption, "max retry wait %s", c.maxRetryWait)
+	case c.maxRequestBody < 0:
+		return errors.Wrapf(ErrInvalidOption, "max request body size %d", c.maxRequestBody)
+	case c.maxResponseBody < 0:
+		return errors.Wrapf(ErrInvalidOption, "max response body size %d", c.maxResponseBody)
+	case c.limiter != nil && !validRate(c.limiter):
+		return errors.Wrap(ErrInvalidOption, "rate limit must be positive")
+	}
+	return nil
+}
+
 // Get makes a HTTP GET request to provided URL.
 func (c *HttpClient) Get(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
-	var response *http.Response
-	if len(c.baseURL) > 0 {
-		url = c.baseURL + url
-	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	request, err := c.newRequest(ctx, http.MethodGet, url, nil, headers)
 	if err != nil {
-		return response, errors.Wrap(err, "GET - request creation failed")
+		return nil, err
 	}
-	request.Header = headers
 	return c.Do(request)
 }
 
 // Post makes a HTTP POST request to provided URL and requestBody.
 func (c *HttpClient) Post(ctx context.Context, url string, body io.Reader, headers http.Header) (*http.Response, error) {
-	var response *http.Response
-	if len(c.baseURL) > 0 {
-		url = c.baseURL + url
-	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	request, err := c.newRequest(ctx, http.MethodPost, url, body, headers)
 	if err != nil {
-		return response, errors.Wrap(err, "POST - request creation failed")
+		return nil, err
 	}
-
-	request.Header = headers
-
 	return c.Do(request)
 }
 
 // Put makes a HTTP PUT request to provided URL and requestBody.
 func (c *HttpClient) Put(ctx context.Context, url string, body io.Reader, headers http.Header) (*http.Response, error) {
-	var response *http.Response
-	if len(c.baseURL) > 0 {
-		url = c.baseURL + url
-	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodPut, url, body)
+	request, err := c.newRequest(ctx, http.MethodPut, url, body, headers)
 	if err != nil {
-		return response, errors.Wrap(err, "PUT - request creation failed")
+		return nil, err
 	}
-
-	request.Header = headers
-
 	return c.Do(request)
 }
 
 // Delete makes a HTTP DELETE request with provided URL.
 func (c *HttpClient) Delete(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
-	var response *http.Response
-	if len(c.baseURL) > 0 {
-		url = c.baseURL + url
-	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	request, err := c.newRequest(ctx, http.MethodDelete, url, nil, headers)
 	if err != nil {
-		return response, errors.Wrap(err, "DELETE - request creation failed")
+		return nil, err
+	}
+	return c.Do(request)
+}
+
+// resolveURL joins the base URL and the path with a single slash. Already
+// escaped segments such as %2F are preserved unless path escaping is on,
+// in which case every path segment is escaped as given.
+func (c *HttpClient) resolveURL(path string) string {
+	if c.escapePath {
+		path = escapePath(path)
 	}
+	if len(c.baseURL) == 0 {
+		return path
+	}
+	if len(path) == 0 || path[0] == '?' {
+		return c.baseURL + path
+	}
+	return strings.TrimRight(c.baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
 
-	request.Header = headers
+func escapePath(path string) string {
+	query := ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i:]
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/") + query
+}
 
-	return c.Do(request)
+// newRequest creates a request for the convenience methods. The supplied
+// headers are copied into the request so the caller's map is never aliased.
+func (c *HttpClient) newRequest(ctx context.Context, method, url string, body io.Reader, headers http.Header) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, c.resolveURL(url), body)
+	if err != nil {
+		return nil, errors.Wrap(err, method+" - request creation failed")
+	}
+	for key, values := range headers {
+		for _, v := range values {
+			request.Header.Add(key, v)
+		}
+	}
+	return request, nil
 }
 
 // Do makes an HTTP request with the native `http.Do` interface.
+// The request context deadline bounds the whole call: once the context is
+// done no further attempt is made and its error is returned.
 func (c *HttpClient) Do(req *http.Request) (resp *http.Response, err error) {
-	var bodyReader *bytes.Reader
+	req, cancel := c.headerDeadline(req)
+	defer func() { cancelWithBody(resp, cancel) }()
+	if c.cache != nil && isCacheableRequest(req) {
+		return c.doCached(req)
+	}
+	return c.do(req)
+}
+
+// headerDeadline bounds a request whose context has no deadline with the
+// timeout carried by the header set with WithTimeoutFromHeader. The cancel
+// function is nil when the context is left as is.
+func (c *HttpClient) headerDeadline(req *http.Request) (*http.Request, context.CancelFunc) {
+	if c.timeoutHeader == "" {
+		return req, nil
+	}
+	if _, ok := req.Context().Deadline(); ok {
+		return req, nil
+	}
+	timeout, ok := parseTimeoutHeader(req.Header.Get(c.timeoutHeader))
+	if !ok {
+		return req, nil
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
 
-	req.Close = true
-	if req.Body != nil {
-		reqData, err := ioutil.ReadAll(req.Body)
+// parseTimeoutHeader parses a duration such as "1.5s", or a plain number
+// of milliseconds. Only positive timeouts are valid.
+func parseTimeoutHeader(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		ms, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
-			return nil, err
+			return 0, false
 		}
-		bodyReader = bytes.NewReader(reqData)
-		req.Body = ioutil.NopCloser(bodyReader)
+		timeout = time.Duration(ms) * time.Millisecond
 	}
+	return timeout, timeout > 0
+}
 
-	multiErr := &valkyrie.MultiError{}
-	var numTries int
+// do sends the request, retrying it according to the client policies.
+func (c *HttpClient) do(req *http.Request) (resp *http.Response, err error) {
+	if c.forceClose {
+		req.Close = true
+	}
+	c.prepareHeaders(req)
+	c.addCookies(req)
+	if err := c.prepareBody(req); err != nil {
+		return nil, err
+	}
+
+	ctx, span := c.startSpan(req)
+	if span != nil {
+		defer func() { endSpan(span, resp, err) }()
+	}
+
+	retryErr := &RetryError{}
+	breaker := c.circuitBreaker(req)
+	var abortErr error
+	var numTries, lastStatus int
+	noRetry := isNoRetry(req.Context())
+	state := &retryState{
+		started:    c.clock.Now(),
+		replayable: isReplayable(req),
+		maxWait:    c.retryCeiling(),
+	}
 	for i := 0; i <= c.retryCount; i++ {
-		isRetryOk := c.retryCount > 0 && i < c.retryCount
-		if resp != nil && resp.Body != nil {
-			_ = resp.Body.Close()
+		isRetryOk := c.canRetry(i) && !noRetry
+		c.discardResponse(resp)
+		if c.limiter != nil {
+			if abortErr = c.limiter.Wait(req.Context()); abortErr != nil {
+				resp = nil
+				break
+			}
 		}
 
-		if c.requestHook != nil {
-			c.requestHook(req, i)
+		if abortErr = rewindBody(req); abortErr != nil {
+			resp = nil
+			break
+		}
+
+		c.setBudgetHeader(req)
+		attemptReq, cancel := c.attemptRequest(req, i)
+		for _, hook := range c.requestHooks {
+			c.guard("request hook", func() { hook(attemptReq, i) })
+		}
+		if abortErr = c.prepareAttempt(attemptReq); abortErr != nil {
+			cancelWithBody(nil, cancel)
+			resp = nil
+			break
+		}
+		// the breaker is asked last so an allowed attempt is always
+		// recorded, a half-open breaker would stay open otherwise
+		if breaker != nil && !breaker.Allow() {
+			cancelWithBody(nil, cancel)
+			resp = nil
+			abortErr = ErrCircuitOpen
+			break
 		}
 
 		var err error
-		resp, err = c.client.Do(req)
-		if bodyReader != nil {
-			_, _ = bodyReader.Seek(0, 0)
+		retryErr.Attempts++
+		resp, err = c.dispatch(ctx, attemptReq, i)
+		if err == nil && c.tokenSource != nil && resp.StatusCode == http.StatusUnauthorized && isReplayable(attemptReq) && !noRetry {
+			resp, err = c.reauthorize(ctx, attemptReq, i, resp)
 		}
+		cancelWithBody(resp, cancel)
+		_ = rewindBody(req)
+		if resp != nil && c.onStatusChange != nil {
+			if lastStatus != 0 && lastStatus != resp.StatusCode {
+				from, to := lastStatus, resp.StatusCode
+				c.guard("status change hook", func() { c.onStatusChange(from, to, i) })
+			}
+			lastStatus = resp.StatusCode
+		}
+		if breaker != nil {
+			breaker.Record(isAttemptSuccess(resp, err))
+		}
+		c.storeCookies(req, resp)
 		if err != nil {
-			if c.errorHook != nil {
-				c.errorHook(req, err, i)
+			for _, hook := range c.errorHooks {
+				c.guard("error hook", func() { hook(req, err, i) })
+			}
+			if c.failureHook != nil {
+				c.guard("failure hook", func() { c.failureHook(req, nil, err, i) })
 			}
 
-			multiErr.Push(err.Error())
+			retryErr.push(err)
 
+			// the server may have processed the request before the
+			// connection failed, only the retryable methods are replayed
+			if !c.retryableMethods[req.Method] {
+				break
+			}
 			if c.checkRetry != nil {
-				checkOK, checkErr := c.checkRetry(req, resp, err)
+				checkOK, checkErr := c.runCheckRetry(req, resp, err)
 				if !checkOK {
 					if checkErr != nil {
-						multiErr.Push(checkErr.Error())
+						retryErr.push(checkErr)
 					}
 					break
 				}
-			}
-			if isRetryOk {
-				wait := c.backOff(i, resp)
-				time.Sleep(wait)
+			} else if !DefaultRetryableError(err) {
+				break
 			}
 			numTries++
+			if !isRetryOk || !c.wait(req, i, resp, state) {
+				break
+			}
 			continue
 		}
 
-		if c.responseHook != nil {
-			c.responseHook(req, resp)
+		if c.autoDecompress {
+			decompressResponse(resp)
+		}
+		if c.decodeCharset {
+			decodeCharset(resp)
+		}
+		if c.maxResponseBody > 0 {
+			limitResponseBody(resp, c.maxResponseBody)
+		}
+		c.normalizeResponseHeaders(resp)
+		if c.captureSink != nil {
+			c.captureBody(resp)
+		}
+		var incompleteErr, bodyErr error
+		if c.retryIncomplete {
+			incompleteErr = bufferResponseBody(resp)
+			bodyErr = incompleteErr
+		}
+		if bodyErr == nil && c.retryEmptyBody && resp.StatusCode == http.StatusOK && emptyResponseBody(resp) {
+			bodyErr = ErrEmptyResponse
 		}
 
+		if len(c.responseHooks) > 0 && !c.finalRespHook {
+			c.runResponseHook(req, resp)
+		}
+
+		if bodyErr != nil {
+			if isRetryOk && c.retryBodyFailure(req, resp, bodyErr, retryErr) {
+				if c.failureHook != nil {
+					c.guard("failure hook", func() { c.failureHook(req, resp, nil, i) })
+				}
+				if c.wait(req, i, resp, state) {
+					numTries++
+					continue
+				}
+			}
+			// an empty body is returned as is, a truncated one fails
+			if incompleteErr != nil {
+				retryErr.push(incompleteErr)
+			}
+			break
+		}
+
+		// the policy is consulted on the last attempt as well, a response
+		// it would retry then fails with ErrRetriesExhausted
+		retriesOn := c.retryCount > 0 && !noRetry
 		var nextLoop bool
-		isDefaultRetryPolicy := resp.StatusCode >= http.StatusInternalServerError && isRetryOk
+		isDefaultRetryPolicy := c.isRetryableStatus(resp.StatusCode) && retriesOn &&
+			c.retryableMethods[req.Method]
 
-		if c.checkRetry != nil && isRetryOk {
-			checkOK, checkErr := c.checkRetry(req, resp, nil)
+		if c.checkRetry != nil && retriesOn {
+			checkOK, checkErr := c.runCheckRetry(req, resp, nil)
 			if !checkOK {
 				if checkErr != nil {
-					multiErr.Push(checkErr.Error())
+					retryErr.push(checkErr)
 				}
 				break
 			}
@@ -191,15 +560,522 @@ func (c *HttpClient) Do(req *http.Request) (resp *http.Response, err error) {
 		}
 
 		if nextLoop {
-			wait := c.backOff(i, resp)
-			time.Sleep(wait)
+			if !isRetryOk {
+				retryErr.push(retriesExhausted(resp, retryErr.Attempts))
+				break
+			}
+			if c.failureHook != nil {
+				c.guard("failure hook", func() { c.failureHook(req, resp, nil, i) })
+			}
+			if !c.wait(req, i, resp, state) {
+				// a done context or a body which can't be replayed
+				// returns the last outcome as is
+				if req.Context().Err() == nil && state.replayable {
+					retryErr.push(retriesExhausted(resp, retryErr.Attempts))
+				}
+				break
+			}
 			numTries++
 			continue
 		}
 		break
 	}
+	if len(c.responseHooks) > 0 && c.finalRespHook && resp != nil {
+		c.runResponseHook(req, resp)
+	}
+	recordResult(req, retryErr)
+	if len(retryErr.Errors) > 0 {
+		if resp != nil {
+			retryErr.LastStatusCode = resp.StatusCode
+		}
+		err = retryErr
+		if c.lastErrorOnly {
+			err = retryErr.Unwrap()
+		}
+	}
+	if state.stopErr != nil {
+		err = state.stopErr
+	}
+	if abortErr != nil {
+		err = abortErr
+	}
+	if err == nil && resp != nil && c.verifyDigest {
+		err = verifyContentDigest(resp)
+	}
+	if err == nil && resp != nil && len(c.validators) > 0 {
+		err = validateResponse(resp, c.validators)
+	}
+	if err == nil && resp != nil && len(c.expectStatus) > 0 {
+		err = expectStatus(resp, c.expectStatus)
+	}
+	if c.onSuccess != nil && err == nil && resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		c.guard("success hook", func() { c.onSuccess(req, resp) })
+	}
+	if c.bodyReadHook != nil {
+		observeResponseBody(req, resp, c.clock, state.started, func(req *http.Request, n int64, d time.Duration) {
+			c.guard("body read hook", func() { c.bodyReadHook(req, n, d) })
+		})
+	}
 	if c.errorHandler != nil {
-		return c.errorHandler(resp, multiErr.HasError(), numTries)
+		return c.runErrorHandler(req, resp, err, numTries)
+	}
+	return resp, err
+}
+
+// retryBodyFailure reports whether a response with an unusable body may be
+// retried. Only the retryable methods are, and CheckRetry has the final
+// say when set, getting the failure as its error.
+func (c *HttpClient) retryBodyFailure(req *http.Request, resp *http.Response, failure error, retryErr *RetryError) bool {
+	if !c.retryableMethods[req.Method] {
+		return false
+	}
+	if c.checkRetry == nil {
+		return true
+	}
+	checkOK, checkErr := c.runCheckRetry(req, resp, failure)
+	if !checkOK && checkErr != nil {
+		retryErr.push(checkErr)
+	}
+	return checkOK
+}
+
+// prepareHeaders adds the client level headers to the request.
+// Headers already present on the request take precedence.
+func (c *HttpClient) prepareHeaders(req *http.Request) {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if len(c.authorization) > 0 && len(req.Header.Get("Authorization")) == 0 {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	if _, ok := req.Header["User-Agent"]; !ok && len(c.userAgent) > 0 {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	if _, ok := req.Header["Accept"]; !ok && len(c.accept) > 0 {
+		req.Header.Set("Accept", c.accept)
+	}
+	mergeHeaders(req.Header, c.defaultHeaders)
+	mergeHeaders(req.Header, c.hostHeaders[strings.ToLower(req.URL.Host)])
+	mergeHeaders(req.Header, c.hostHeaders[strings.ToLower(req.URL.Hostname())])
+	if len(c.requestIDHeader) > 0 && len(req.Header.Get(c.requestIDHeader)) == 0 {
+		if id := c.requestID(req.Context()); len(id) > 0 {
+			req.Header.Set(c.requestIDHeader, id)
+		}
+	}
+	if len(c.sequenceHeader) > 0 {
+		seq := atomic.AddUint64(c.sequence, 1)
+		req.Header.Set(c.sequenceHeader, strconv.FormatUint(seq, 10))
+	}
+}
+
+// attemptRequest returns the request sent for the given attempt, carrying
+// the context derived by WithAttemptContext and bounded by the per attempt
+// timeout. The returned cancel func, if any, releases the attempt context.
+func (c *HttpClient) attemptRequest(req *http.Request, attempt int) (*http.Request, context.CancelFunc) {
+	if c.attemptContext == nil && c.attemptTimeout <= 0 && c.shutdownGrace <= 0 {
+		return req, nil
+	}
+	ctx := req.Context()
+	if c.attemptContext != nil {
+		ctx = c.attemptContext(ctx, attempt)
+	}
+	var cancels []context.CancelFunc
+	if c.shutdownGrace > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = withGrace(ctx, c.shutdownGrace)
+		cancels = append(cancels, cancel)
+	}
+	if c.attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.attemptTimeout)
+		cancels = append(cancels, cancel)
+	}
+	if len(cancels) == 0 {
+		return req.WithContext(ctx), nil
+	}
+	return req.WithContext(ctx), func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
+// cancelWithBody defers cancel until the response body is closed, since
+// reading the body still needs the attempt context.
+func cancelWithBody(resp *http.Response, cancel context.CancelFunc) {
+	if cancel == nil {
+		return
+	}
+	if resp == nil || resp.Body == nil {
+		cancel()
+		return
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	closed bool
+}
+
+// Close closes the wrapped body once, later calls are no-ops.
+func (b *cancelBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// mergeHeaders copies the headers missing from dst.
+func mergeHeaders(dst, src http.Header) {
+	for key, values := range src {
+		if len(dst.Values(key)) > 0 {
+			continue
+		}
+		dst[key] = append([]string(nil), values...)
+	}
+}
+
+// dispatch sends a single attempt through the underlying Doer.
+func (c *HttpClient) dispatch(ctx context.Context, req *http.Request, attempt int) (*http.Response, error) {
+	span := c.startAttemptSpan(ctx, req, attempt)
+	observe := c.logger != nil || (!c.observableDoer && (c.metrics != nil || c.latency != nil))
+	var start time.Time
+	if observe {
+		start = c.clock.Now()
+	}
+	var resp *http.Response
+	var err error
+	if c.canHedge(req) {
+		resp, err = c.hedge(c.doer(req), req)
+	} else {
+		resp, err = c.doer(req).Do(req)
+	}
+	if observe {
+		duration := c.clock.Now().Sub(start)
+		if !c.observableDoer {
+			c.observeRequest(req, resp, duration)
+		}
+		if c.logger != nil {
+			c.logAttempt(req, resp, err, attempt, duration)
+		}
+	}
+	endSpan(span, resp, err)
+	return resp, err
+}
+
+// doer returns the Doer registered for the request scheme or the default one.
+func (c *HttpClient) doer(req *http.Request) Doer {
+	if doer, ok := c.schemeDoers[strings.ToLower(req.URL.Scheme)]; ok {
+		return doer
+	}
+	return c.client
+}
+
+// prepareBody makes the request body replayable on retries. Requests with
+// GetBody set regenerate their body for each attempt, other bodies are
+// buffered once in memory. Compressed bodies are always buffered.
+func (c *HttpClient) prepareBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil && c.noBodyBuffering && !c.compressRequest {
+		return c.limitRequestBody(req)
+	}
+	if req.GetBody != nil && !c.compressRequest {
+		if c.maxRequestBody > 0 && req.ContentLength > c.maxRequestBody {
+			return errors.Wrapf(ErrRequestBodyTooLarge, "limit %d bytes", c.maxRequestBody)
+		}
+		return req.Body.Close()
+	}
+	data, err := c.readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	if c.compressRequest {
+		if data, err = compressRequestBody(req, data); err != nil {
+			return err
+		}
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
+
+// isReplayable reports whether the request body can be sent again.
+func isReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewindBody replaces the request body with a fresh copy.
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return errors.Wrap(err, "request body rewind failed")
+	}
+	req.Body = body
+	return nil
+}
+
+// readRequestBody reads the whole request body.
+func (c *HttpClient) readRequestBody(req *http.Request) ([]byte, error) {
+	defer req.Body.Close()
+	if c.maxRequestBody <= 0 {
+		return ioutil.ReadAll(req.Body)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, c.maxRequestBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.maxRequestBody {
+		return nil, errors.Wrapf(ErrRequestBodyTooLarge, "limit %d bytes", c.maxRequestBody)
+	}
+	return data, nil
+}
+
+// limitRequestBody enforces the request body size limit on a body which is
+// streamed rather than buffered. A body with a known oversized length is
+// rejected before sending, any other fails with ErrRequestBodyTooLarge
+// once the limit is exceeded while it is sent.
+func (c *HttpClient) limitRequestBody(req *http.Request) error {
+	if c.maxRequestBody <= 0 {
+		return nil
+	}
+	tooLarge := errors.Wrapf(ErrRequestBodyTooLarge, "limit %d bytes", c.maxRequestBody)
+	if req.ContentLength > c.maxRequestBody {
+		_ = req.Body.Close()
+		return tooLarge
+	}
+	req.Body = &limitedBody{body: req.Body, remaining: c.maxRequestBody, tooLarge: tooLarge}
+	return nil
+}
+
+// runResponseHook invokes the response hooks. In async mode the hooks run
+// in their own goroutine on copies of the request and response without
+// the body.
+func (c *HttpClient) runResponseHook(req *http.Request, resp *http.Response) {
+	if !c.asyncRespHook {
+		for _, hook := range c.responseHooks {
+			c.guard("response hook", func() { hook(req, resp) })
+		}
+		return
+	}
+	reqCopy := req.Clone(req.Context())
+	reqCopy.Body = http.NoBody
+	respCopy := *resp
+	respCopy.Header = resp.Header.Clone()
+	respCopy.Body = http.NoBody
+	respCopy.Request = reqCopy
+	go func() {
+		for _, hook := range c.responseHooks {
+			c.guard("response hook", func() { hook(reqCopy, &respCopy) })
+		}
+	}()
+}
+
+// setBudgetHeader sets the remaining time budget of the request context
+// in milliseconds so the upstream can limit its own work.
+func (c *HttpClient) setBudgetHeader(req *http.Request) {
+	if len(c.budgetHeader) == 0 {
+		return
+	}
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(deadline) / time.Millisecond
+	if remaining < 0 {
+		remaining = 0
+	}
+	req.Header.Set(c.budgetHeader, strconv.FormatInt(int64(remaining), 10))
+}
+
+// canRetry reports whether another attempt may follow the given one.
+func (c *HttpClient) canRetry(attemptNum int) bool {
+	if c.retryWaits != nil && attemptNum >= len(c.retryWaits) {
+		return false
+	}
+	return c.retryCount > 0 && attemptNum < c.retryCount
+}
+
+type noRetryKey struct{}
+
+// WithNoRetry returns a copy of ctx making Do send the request it carries
+// exactly once, whatever the retry count and CheckRetry of the client.
+func WithNoRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func isNoRetry(ctx context.Context) bool {
+	noRetry, _ := ctx.Value(noRetryKey{}).(bool)
+	return noRetry
+}
+
+// isRetryableStatus reports whether the default retry policy retries on
+// the status code: a 5xx or one of the codes set by WithRetryStatusCodes.
+func (c *HttpClient) isRetryableStatus(code int) bool {
+	if c.retryStatusCodes != nil {
+		return c.retryStatusCodes[code]
+	}
+	return code >= http.StatusInternalServerError
+}
+
+// retryState tracks a single Do call across its attempts.
+type retryState struct {
+	started    time.Time
+	replayable bool
+	maxWait    time.Duration
+	// stopErr is returned by Do when retrying had to stop early.
+	stopErr error
+}
+
+// wait sleeps before the next attempt for the duration computed by the
+// back off policy or taken from the retry wait schedule. It returns false
+// without sleeping when the request can't be retried: its body can't be
+// replayed or the retry budget would be exceeded by the wait.
+func (c *HttpClient) wait(req *http.Request, attemptNum int, resp *http.Response, state *retryState) bool {
+	if !state.replayable {
+		if c.requireReplayable {
+			state.stopErr = ErrBodyNotReplayable
+		}
+		return false
+	}
+	if err := req.Context().Err(); err != nil {
+		c.stopOnDone(state, err)
+		return false
+	}
+	var wait time.Duration
+	if c.retryWaits != nil {
+		wait = c.retryWaits[attemptNum]
+	} else {
+		wait = c.runBackOff(attemptNum, resp)
+	}
+	wait = clampWait(wait, state.maxWait)
+	if c.backOffHook != nil {
+		// a recovered panic keeps the wait computed by the policy
+		hooked := wait
+		if c.guard("back off hook", func() { c.backOffHook(attemptNum, resp, &hooked) }) {
+			wait = clampWait(hooked, state.maxWait)
+		}
+	}
+	if c.retryBudget > 0 {
+		throttled := c.clock.Now().Sub(state.started)+wait > c.retryBudget
+		c.observeRetryThrottle(throttled)
+		if throttled {
+			return false
+		}
+	}
+	if c.metrics != nil {
+		c.metrics.IncRetry(req.Method, req.URL.Host)
+	}
+	if c.logger != nil {
+		c.logRetry(req, attemptNum, wait)
+	}
+	if err := c.sleep(req, wait); err != nil {
+		c.stopOnDone(state, err)
+		return false
+	}
+	return true
+}
+
+// sleep pauses before the next attempt. With a retry probe configured the
+// pause ends early as soon as the probe reports the host healthy. It
+// returns the context error when the request context is done first.
+func (c *HttpClient) sleep(req *http.Request, wait time.Duration) error {
+	probe := len(c.probePath) > 0 && wait > 0
+	done := req.Context().Done()
+	if !probe && done == nil {
+		c.clock.Sleep(wait)
+		return nil
+	}
+	var healthy chan bool
+	if probe {
+		healthy = make(chan bool, 1)
+		go func() { healthy <- c.probe(req) }()
+	}
+	elapsed := c.clock.After(wait)
+	for {
+		select {
+		case <-elapsed:
+			return nil
+		case ok := <-healthy:
+			if ok {
+				return nil
+			}
+			healthy = nil
+		case <-done:
+			return req.Context().Err()
+		}
+	}
+}
+
+// probe sends a GET request to the probe path of the request host and
+// reports whether it answered with a 2xx status in time.
+func (c *HttpClient) probe(req *http.Request) bool {
+	ctx, cancel := context.WithTimeout(req.Context(), c.probeTimeout)
+	defer cancel()
+	u := *req.URL
+	u.Path, u.RawPath, u.RawQuery, u.Fragment = c.probePath, "", "", ""
+	probeReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.doer(probeReq).Do(probeReq)
+	if err != nil {
+		return false
+	}
+	c.discardResponse(resp)
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// stopOnDone records the context error which stopped the retries. With a
+// shutdown grace the outcome of the last attempt is returned instead.
+func (c *HttpClient) stopOnDone(state *retryState, err error) {
+	if c.shutdownGrace <= 0 {
+		state.stopErr = err
+	}
+}
+
+// clampWait caps the wait at the limit, zero means no limit.
+func clampWait(wait, limit time.Duration) time.Duration {
+	if limit > 0 && wait > limit {
+		return limit
+	}
+	return wait
+}
+
+// retryCeiling returns the wait limit of a Do call. With ceiling
+// randomization it is picked at random within the band below the limit
+// set by WithMaxRetryWait.
+func (c *HttpClient) retryCeiling() time.Duration {
+	if c.maxRetryWait <= 0 || c.ceilingBand <= 0 {
+		return c.maxRetryWait
+	}
+	spread := float64(c.maxRetryWait) * c.ceilingBand * c.rand.Float64()
+	return c.maxRetryWait - time.Duration(spread)
+}
+
+// maxDrainSize bounds the bytes read from a discarded response body. A
+// larger body costs more to read than a new connection does.
+const maxDrainSize = 64 << 10
+
+// discardResponse releases a response which is not returned to the caller.
+// Up to maxDrainSize bytes of the body are drained before closing so the
+// connection can be reused.
+func (c *HttpClient) discardResponse(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	if !c.keepRetryBody {
+		_, _ = io.CopyN(ioutil.Discard, resp.Body, maxDrainSize)
 	}
-	return resp, multiErr.HasError()
+	_ = resp.Body.Close()
 }
@@ -3,9 +3,19 @@ package httpclient
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -87,6 +97,7 @@ func TestHttpClient_DoErrorWithRetry(t *testing.T) {
 	)
 	client, doer, done := newClient(t,
 		WithRetryCount(retryCount),
+		WithRetryableMethods(http.MethodPost),
 		WithResponseHook(func(request *http.Request, response *http.Response) {
 			assert.Nil(t, response)
 			assert.Nil(t, request)
@@ -109,6 +120,23 @@ func TestHttpClient_DoErrorWithRetry(t *testing.T) {
 	assert.Equal(t, haveRetry-1, retryCount)
 }
 
+func TestHttpClient_DoErrorNonIdempotentNotRetried(t *testing.T) {
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	for name, opt := range map[string]Option{
+		"default policy": WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		"check retry": WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			return true, nil
+		}),
+	} {
+		client, doer, done := newClient(t, WithRetryCount(3), opt)
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(nil, resetErr)
+		resp, err := client.Post(context.Background(), "https://google.com", bytes.NewReader([]byte("charge")), nil)
+		assert.True(t, errors.Is(err, syscall.ECONNRESET), name)
+		assert.Nil(t, resp, name)
+		done()
+	}
+}
+
 func TestHttpClient_DoErrorWithRetryAndCheckRetry(t *testing.T) {
 	var (
 		retryCount = 3
@@ -155,7 +183,7 @@ func TestHttpClient_DoWithRetryHTTP500(t *testing.T) {
 		}),
 	)
 	defer done()
-	req, err := http.NewRequest(http.MethodPost, "https://google.com", bytes.NewBuffer(payload))
+	req, err := http.NewRequest(http.MethodPut, "https://google.com", bytes.NewBuffer(payload))
 	assert.Nil(t, err)
 	doer.EXPECT().Do(req).Times(wantRetries).Return(&http.Response{
 		StatusCode: 500,
@@ -165,7 +193,7 @@ func TestHttpClient_DoWithRetryHTTP500(t *testing.T) {
 		assert.Equal(t, payload, body)
 	})
 	haveResp, err := client.Do(req)
-	assert.Nil(t, err)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
 	assert.Equal(t, wantRetries, haveRetries)
 	assert.Equal(t, haveResp.StatusCode, http.StatusInternalServerError)
 }
@@ -206,6 +234,29 @@ func TestHttpClient_DoWithRetryHTTP200(t *testing.T) {
 	assert.Equal(t, b, payload)
 }
 
+func TestHttpClient_RequestErrorHandler(t *testing.T) {
+	type traceKey struct{}
+	fallback := &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithRequestErrorHandler(func(ctx context.Context, req *http.Request, resp *http.Response, err error, numTries int) (*http.Response, error) {
+			assert.Equal(t, "trace-1", ctx.Value(traceKey{}))
+			assert.Equal(t, "https://google.com/users?id=1", req.URL.String())
+			assert.True(t, errors.Is(err, someErr))
+			assert.Equal(t, 2, numTries)
+			return fallback, nil
+		}),
+	)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(nil, someErr)
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-1")
+	resp, err := client.Get(ctx, "https://google.com/users?id=1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, fallback, resp)
+}
+
 func TestHttpClient_DoWithRetryAndCheckRetryPolicyHTTP200(t *testing.T) {
 	payload := []byte(`{"test":"test"}`)
 	var haveRetries int
@@ -365,3 +416,1448 @@ func TestHttpClient_Get(t *testing.T) {
 	assert.EqualError(t, err, someErr.Error())
 	assert.Nil(t, resp)
 }
+
+func TestHttpClient_DefaultHeaders(t *testing.T) {
+	defaults := make(http.Header)
+	defaults.Set("Accept", "application/json")
+	defaults.Set("User-Agent", "httpclient")
+	defaults.Add("X-Api-Key", "one")
+	defaults.Add("X-Api-Key", "two")
+	client, doer, done := newClient(t, WithDefaultHeaders(defaults))
+	defer done()
+
+	ctx := context.TODO()
+
+	// defaults applied
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+	}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "application/json", req.Header.Get("Accept"))
+		assert.Equal(t, "httpclient", req.Header.Get("User-Agent"))
+		assert.Equal(t, []string{"one", "two"}, req.Header.Values("X-Api-Key"))
+	})
+	_, err := client.Get(ctx, "http://test.com/path", nil)
+	assert.Nil(t, err)
+
+	// defaults overridden by per-call headers, caller headers not mutated
+	callHeaders := make(http.Header)
+	callHeaders.Set("Accept", "text/plain")
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+	}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, []string{"text/plain"}, req.Header.Values("Accept"))
+		assert.Equal(t, "httpclient", req.Header.Get("User-Agent"))
+	})
+	_, err = client.Get(ctx, "http://test.com/path", callHeaders)
+	assert.Nil(t, err)
+	assert.Len(t, callHeaders, 1)
+	assert.Equal(t, "text/plain", callHeaders.Get("Accept"))
+}
+
+func TestHttpClient_VerifyContentDigest(t *testing.T) {
+	client, doer, done := newClient(t, WithVerifyContentDigest())
+	defer done()
+
+	payload := []byte(`{"test":"test"}`)
+	sum := md5.Sum(payload)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	// matching digest
+	respHeader := make(http.Header)
+	respHeader.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	doer.EXPECT().Do(req).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Header:     respHeader,
+		Body:       ioutil.NopCloser(bytes.NewReader(payload)),
+	}, nil)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+
+	// mismatching digest
+	respHeader = make(http.Header)
+	respHeader.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	doer.EXPECT().Do(req).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Header:     respHeader,
+		Body:       ioutil.NopCloser(bytes.NewReader(payload)),
+	}, nil)
+	resp, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrDigestMismatch))
+	b, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+}
+
+func TestHttpClient_HeadersNotAliased(t *testing.T) {
+	defaults := make(http.Header)
+	defaults.Set("X-Default", "default")
+	client, doer, done := newClient(t, WithDefaultHeaders(defaults))
+	defer done()
+
+	callHeaders := make(http.Header)
+	callHeaders.Add("X-Call", "one")
+	callHeaders.Add("X-Call", "two")
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{
+		StatusCode: 200,
+	}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, []string{"one", "two"}, req.Header.Values("X-Call"))
+		assert.Equal(t, "default", req.Header.Get("X-Default"))
+		req.Header.Set("X-Mutated", "yes")
+	})
+	_, err := client.Post(context.TODO(), "http://test.com/path", nil, callHeaders)
+	assert.Nil(t, err)
+	assert.Equal(t, http.Header{"X-Call": {"one", "two"}}, callHeaders)
+}
+
+func TestHttpClient_Authorization(t *testing.T) {
+	ctx := context.TODO()
+	resp := &http.Response{StatusCode: 200}
+
+	// bearer token
+	client, doer, done := newClient(t, WithBearerToken("secret"))
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(resp, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	})
+	_, err := client.Get(ctx, "http://test.com/path", nil)
+	assert.Nil(t, err)
+
+	// empty per-request authorization doesn't override the token
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(resp, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	})
+	_, err = client.Get(ctx, "http://test.com/path", http.Header{"Authorization": {""}})
+	assert.Nil(t, err)
+
+	// explicit per-request authorization takes precedence
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(resp, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "Bearer other", req.Header.Get("Authorization"))
+	})
+	_, err = client.Get(ctx, "http://test.com/path", http.Header{"Authorization": {"Bearer other"}})
+	assert.Nil(t, err)
+	done()
+
+	// basic auth
+	client, doer, done = newClient(t, WithBasicAuth("user", "pass"))
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(resp, nil).Do(func(req *http.Request) {
+		user, pass, ok := req.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "pass", pass)
+	})
+	_, err = client.Get(ctx, "http://test.com/path", nil)
+	assert.Nil(t, err)
+}
+
+type trackingBody struct {
+	r           io.Reader
+	read        int
+	readAtClose int
+	closed      int
+	eof         bool
+}
+
+func newTrackingBody(payload []byte) *trackingBody {
+	return &trackingBody{r: bytes.NewReader(payload)}
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += n
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *trackingBody) Close() error {
+	b.readAtClose = b.read
+	b.closed++
+	return nil
+}
+
+func TestHttpClient_ResponseBodyDiscardOnRetry(t *testing.T) {
+	payload := []byte(`{"error":"internal"}`)
+	for _, discard := range []bool{true, false} {
+		client, doer, done := newClient(t,
+			WithRetryCount(1),
+			WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+			WithResponseBodyDiscardOnRetry(discard),
+		)
+		req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+		assert.Nil(t, err)
+		first := newTrackingBody(payload)
+		second := newTrackingBody(payload)
+		gomock.InOrder(
+			doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 500, Body: first}, nil),
+			doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 500, Body: second}, nil),
+		)
+		resp, err := client.Do(req)
+		assert.True(t, errors.Is(err, ErrRetriesExhausted))
+		assert.Equal(t, second, resp.Body)
+		assert.Equal(t, 1, first.closed)
+		assert.Equal(t, discard, first.eof)
+		if discard {
+			assert.Equal(t, len(payload), first.read)
+		} else {
+			assert.Equal(t, 0, first.read)
+		}
+		assert.Equal(t, 0, second.closed)
+		done()
+	}
+}
+
+func TestHttpClient_DrainBeforeCloseOnRetry(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+
+	small := newTrackingBody([]byte(`{"error":"internal"}`))
+	large := newTrackingBody(bytes.Repeat([]byte("x"), 2*maxDrainSize))
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500, Body: small}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500, Body: large}, nil),
+	)
+	_, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, small.closed)
+	assert.True(t, small.eof)
+	assert.Equal(t, small.read, small.readAtClose)
+	// the last response goes to the caller untouched
+	assert.Equal(t, 0, large.closed)
+
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500, Body: large}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil),
+	)
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, large.closed)
+	assert.False(t, large.eof)
+	assert.Equal(t, maxDrainSize, large.readAtClose)
+}
+
+func TestHttpClient_NoBodyLeakOnRetry(t *testing.T) {
+	var bodies []*trackingBody
+	respond := func(code int) func(*http.Request) (*http.Response, error) {
+		return func(*http.Request) (*http.Response, error) {
+			body := newTrackingBody([]byte(`{"status":"` + strconv.Itoa(code) + `"}`))
+			bodies = append(bodies, body)
+			return &http.Response{StatusCode: code, Body: body}, nil
+		}
+	}
+	assertClosed := func(attempts int, resp *http.Response) {
+		assert.Len(t, bodies, attempts)
+		for _, body := range bodies[:attempts-1] {
+			assert.Equal(t, 1, body.closed)
+		}
+		last := bodies[attempts-1]
+		assert.Equal(t, 0, last.closed)
+		assert.Nil(t, resp.Body.Close())
+		assert.Equal(t, 1, last.closed)
+		bodies = nil
+	}
+	backOff := WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 })
+
+	// retried 500s ending in exhaustion
+	client, doer, done := newClient(t, WithRetryCount(3), backOff, WithPerAttemptTimeout(time.Minute))
+	doer.EXPECT().Do(gomock.Any()).Times(4).DoAndReturn(respond(500))
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	last := bodies[3]
+	assertClosed(4, resp)
+	// the body wrapped to cancel the attempt context closes once
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, 1, last.closed)
+	done()
+
+	// successful responses retried by CheckRetry until exhaustion
+	client, doer, done = newClient(t, WithRetryCount(2), backOff,
+		WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			return true, nil
+		}),
+	)
+	doer.EXPECT().Do(gomock.Any()).Times(3).DoAndReturn(respond(200))
+	resp, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assertClosed(3, resp)
+	done()
+
+	// retries stopped by the context
+	ctx, cancel := context.WithCancel(context.Background())
+	client, doer, done = newClient(t, WithRetryCount(3), backOff)
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(500)),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			cancel()
+			return respond(502)(req)
+		}),
+	)
+	resp, err = client.Get(ctx, "https://google.com", nil)
+	assert.Equal(t, context.Canceled, err)
+	assertClosed(2, resp)
+	done()
+}
+
+func TestHttpClient_FailureHook(t *testing.T) {
+	var failures []int
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithFailureHook(func(req *http.Request, resp *http.Response, err error, retry int) {
+			assert.Nil(t, err)
+			assert.Equal(t, 0, retry)
+			failures = append(failures, resp.StatusCode)
+		}),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	gomock.InOrder(
+		doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 500}, nil),
+		doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []int{http.StatusInternalServerError}, failures)
+}
+
+func TestHttpClient_CookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			return
+		}
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(cookie.Value))
+	}))
+	defer server.Close()
+
+	for _, doer := range []Doer{nil, &http.Client{}} {
+		jar, err := NewCookieJar()
+		assert.Nil(t, err)
+		client, err := New(WithDoer(doer), WithCookieJar(jar), WithBaseURL(server.URL))
+		assert.Nil(t, err)
+
+		resp, err := client.Get(context.TODO(), "/login", nil)
+		assert.Nil(t, err)
+		_ = resp.Body.Close()
+
+		resp, err = client.Get(context.TODO(), "/me", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, "abc", string(b))
+		_ = resp.Body.Close()
+	}
+}
+
+func TestHttpClient_ResponseHookSkipOnRetry(t *testing.T) {
+	var statuses []int
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithResponseHookSkipOnRetry(true),
+		WithResponseHook(func(request *http.Request, response *http.Response) {
+			statuses = append(statuses, response.StatusCode)
+		}),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	gomock.InOrder(
+		doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 500}, nil),
+		doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(req).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []int{http.StatusOK}, statuses)
+}
+
+func TestHttpClient_Redirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+	ctx := context.TODO()
+
+	// redirects are followed
+	client, err := New(WithBaseURL(server.URL))
+	assert.Nil(t, err)
+	resp, err := client.Get(ctx, "/a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "/c", resp.Request.URL.Path)
+
+	// redirects are blocked
+	client, err = New(WithBaseURL(server.URL), WithNoRedirect())
+	assert.Nil(t, err)
+	resp, err = client.Get(ctx, "/a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/b", resp.Header.Get("Location"))
+
+	// redirects are limited
+	client, err = New(WithBaseURL(server.URL), WithCheckRedirect(func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 1 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	}))
+	assert.Nil(t, err)
+	_, err = client.Get(ctx, "/a", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too many redirects")
+
+	// custom doer is left untouched
+	client, err = New(WithDoer(&http.Client{}), WithBaseURL(server.URL), WithNoRedirect())
+	assert.Nil(t, err)
+	resp, err = client.Get(ctx, "/a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHttpClient_BackOffHook(t *testing.T) {
+	var waits []time.Duration
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration {
+			return time.Duration(attemptNum+1) * time.Hour
+		}),
+		WithBackOffHook(func(attemptNum int, resp *http.Response, wait *time.Duration) {
+			waits = append(waits, *wait)
+			*wait = time.Millisecond
+		}),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	doer.EXPECT().Do(req).Times(4).Return(&http.Response{StatusCode: 500}, nil)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour}, waits)
+}
+
+func TestHttpClient_BudgetHeader(t *testing.T) {
+	var budgets []int
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 20 * time.Millisecond }),
+		WithBudgetHeader("X-Budget"),
+	)
+	defer done()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 500}, nil).Do(func(req *http.Request) {
+		budget, err := strconv.Atoi(req.Header.Get("X-Budget"))
+		assert.Nil(t, err)
+		budgets = append(budgets, budget)
+	})
+	_, err := client.Get(ctx, "https://google.com", nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Len(t, budgets, 3)
+	assert.True(t, budgets[0] <= 10000 && budgets[0] > 9000)
+	assert.True(t, budgets[1] < budgets[0])
+	assert.True(t, budgets[2] < budgets[1])
+
+	// no deadline, no header
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Empty(t, req.Header.Get("X-Budget"))
+	})
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_RetryForIncompleteResponse(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithRetryForIncompleteResponse(),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	truncated := newTrackingBody(payload[:5])
+	gomock.InOrder(
+		doer.EXPECT().Do(req).Return(&http.Response{
+			StatusCode:    200,
+			ContentLength: int64(len(payload)),
+			Body:          truncated,
+		}, nil),
+		doer.EXPECT().Do(req).Return(&http.Response{
+			StatusCode:    200,
+			ContentLength: int64(len(payload)),
+			Body:          ioutil.NopCloser(bytes.NewReader(payload)),
+		}, nil),
+	)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+	assert.Equal(t, 1, truncated.closed)
+
+	// retries exhausted
+	doer.EXPECT().Do(req).Times(2).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: int64(len(payload)),
+			Body:          ioutil.NopCloser(bytes.NewReader(payload[:5])),
+		}, nil
+	})
+	resp, err = client.Do(req)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ErrIncompleteResponse.Error())
+	b, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload[:5], b)
+}
+
+func TestHttpClient_RetryForIncompleteResponsePolicy(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	truncated := func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    200,
+			ContentLength: int64(len(payload)),
+			Body:          ioutil.NopCloser(bytes.NewReader(payload[:5])),
+		}, nil
+	}
+	noBackOff := WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 })
+	ctx := context.Background()
+
+	// non idempotent methods are sent once
+	client, doer, done := newClient(t, WithRetryCount(3), noBackOff, WithRetryForIncompleteResponse())
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(truncated)
+	_, err := client.Post(ctx, "https://google.com", nil, nil)
+	assert.True(t, errors.Is(err, ErrIncompleteResponse))
+
+	// CheckRetry gets the failure and decides
+	var checked []error
+	client, doer, done = newClient(t, WithRetryCount(3), noBackOff, WithRetryForIncompleteResponse(),
+		WithRetryableMethods(http.MethodPost),
+		WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			checked = append(checked, err)
+			return false, nil
+		}),
+	)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(truncated)
+	_, err = client.Post(ctx, "https://google.com", nil, nil)
+	assert.True(t, errors.Is(err, ErrIncompleteResponse))
+	assert.Len(t, checked, 1)
+	assert.True(t, errors.Is(checked[0], ErrIncompleteResponse))
+}
+
+func TestHttpClient_RetryOnEmptyBody(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithRetryOnEmptyBody(),
+	)
+	defer done()
+	empty := newTrackingBody(nil)
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200, Body: empty}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(payload)),
+		}, nil),
+	)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+	assert.Equal(t, 1, empty.closed)
+
+	// retries exhausted
+	doer.EXPECT().Do(gomock.Any()).Times(2).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+	resp, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	b, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Empty(t, b)
+
+	// other statuses are left alone
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 204, Body: http.NoBody}, nil)
+	resp, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+}
+
+func TestHttpClient_RetryOnEmptyBodyPolicy(t *testing.T) {
+	noBackOff := WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 })
+	ctx := context.Background()
+
+	// non idempotent methods are sent once
+	client, doer, done := newClient(t, WithRetryCount(3), noBackOff, WithRetryOnEmptyBody())
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil)
+	resp, err := client.Post(ctx, "https://google.com", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	// CheckRetry gets the failure and decides
+	var checked []error
+	client, doer, done = newClient(t, WithRetryCount(3), noBackOff, WithRetryOnEmptyBody(),
+		WithRetryableMethods(http.MethodPost),
+		WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			checked = append(checked, err)
+			return false, nil
+		}),
+	)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil)
+	resp, err = client.Post(ctx, "https://google.com", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []error{ErrEmptyResponse}, checked)
+}
+
+func TestHttpClient_BodyRetryHooks(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	for name, opt := range map[string]Option{
+		"empty body":      WithRetryOnEmptyBody(),
+		"incomplete body": WithRetryForIncompleteResponse(),
+	} {
+		var responses, failures int
+		client, doer, done := newClient(t,
+			opt,
+			WithRetryCount(1),
+			WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+			WithResponseHook(func(req *http.Request, resp *http.Response) { responses++ }),
+			WithFailureHook(func(req *http.Request, resp *http.Response, err error, retry int) { failures++ }),
+		)
+		// the first attempt is retried, the second is returned
+		doer.EXPECT().Do(gomock.Any()).Times(2).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    200,
+				ContentLength: int64(len(payload)),
+				Body:          ioutil.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		})
+		_, _ = client.Get(context.Background(), "https://google.com", nil)
+		assert.Equal(t, 2, responses, name)
+		assert.Equal(t, 1, failures, name)
+		done()
+	}
+}
+
+func TestHttpClient_MaxRequestBodySize(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	client, doer, done := newClient(t, WithMaxRequestBodySize(int64(len(payload))))
+	defer done()
+	ctx := context.TODO()
+
+	// at the limit
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, body)
+	})
+	_, err := client.Post(ctx, "http://test.com", bytes.NewReader(payload), nil)
+	assert.Nil(t, err)
+
+	// oversized body, the doer isn't called
+	resp, err := client.Post(ctx, "http://test.com", bytes.NewReader(append(payload, '!')), nil)
+	assert.True(t, errors.Is(err, ErrRequestBodyTooLarge))
+	assert.Nil(t, resp)
+}
+
+func TestHttpClient_MaxRequestBodySizeStreamed(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	client, doer, done := newClient(t, WithMaxRequestBodySize(int64(len(payload))), WithBodyBuffering(false))
+	defer done()
+	ctx := context.TODO()
+	stream := func(b []byte) io.Reader { return io.MultiReader(bytes.NewReader(b)) }
+	send := func(req *http.Request) (*http.Response, error) {
+		if _, err := ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: 200}, nil
+	}
+
+	// at the limit
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(send)
+	_, err := client.Post(ctx, "http://test.com", stream(payload), nil)
+	assert.Nil(t, err)
+
+	// oversized body of unknown length, fails while sent
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(send)
+	resp, err := client.Post(ctx, "http://test.com", stream(append(payload, '!')), nil)
+	assert.True(t, errors.Is(err, ErrRequestBodyTooLarge))
+	assert.Nil(t, resp)
+
+	// oversized body of known length, the doer isn't called
+	resp, err = client.Post(ctx, "http://test.com", bytes.NewReader(append(payload, '!')), nil)
+	assert.True(t, errors.Is(err, ErrRequestBodyTooLarge))
+	assert.Nil(t, resp)
+}
+
+func TestHttpClient_ResponseHeaderNormalization(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithResponseHeaderNormalization(HeaderFirstWins, "content-type"),
+		WithResponseHeaderNormalization(HeaderJoin, "Vary"),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	doer.EXPECT().Do(req).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Header: http.Header{
+			"Content-Type": {"application/json", "text/plain"},
+			"Vary":         {"Accept", "Origin"},
+			"Set-Cookie":   {"a=1", "b=2"},
+		},
+	}, nil)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"application/json"}, resp.Header.Values("Content-Type"))
+	assert.Equal(t, []string{"Accept, Origin"}, resp.Header.Values("Vary"))
+	assert.Equal(t, []string{"a=1", "b=2"}, resp.Header.Values("Set-Cookie"))
+}
+
+func TestNormalizeHeader(t *testing.T) {
+	h := http.Header{"Content-Type": {"a", "b", "c"}}
+	NormalizeHeader(h, "Content-Type", HeaderLastWins)
+	assert.Equal(t, []string{"c"}, h.Values("Content-Type"))
+}
+
+func TestHttpClient_SequenceHeader(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithSequenceHeader("X-Sequence"),
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+	var sequences []string
+	record := func(req *http.Request) {
+		sequences = append(sequences, req.Header.Get("X-Sequence"))
+	}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(record),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500}, nil).Do(record),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(record),
+	)
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(context.TODO(), "http://test.com", nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []string{"1", "2", "2"}, sequences)
+}
+
+func TestHttpClient_ResponseHookAsync(t *testing.T) {
+	release := make(chan struct{})
+	called := make(chan *http.Response, 1)
+	client, doer, done := newClient(t,
+		WithResponseHookAsync(),
+		WithResponseHook(func(request *http.Request, response *http.Response) {
+			<-release
+			called <- response
+		}),
+	)
+	defer done()
+	payload := []byte(`{"test":"test"}`)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	doer.EXPECT().Do(req).Times(1).Return(&http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"X-Key": {"value"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(payload)),
+	}, nil)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, b)
+
+	close(release)
+	hookResp := <-called
+	assert.Equal(t, http.StatusOK, hookResp.StatusCode)
+	assert.Equal(t, "value", hookResp.Header.Get("X-Key"))
+	assert.Equal(t, http.NoBody, hookResp.Body)
+}
+
+func TestHttpClient_RetryWaits(t *testing.T) {
+	schedule := []time.Duration{time.Second, 2 * time.Second, 5 * time.Second}
+	var waits []time.Duration
+	client, doer, done := newClient(t,
+		WithRetryCount(10),
+		WithRetryWaits(schedule),
+		WithBackOffHook(func(attemptNum int, resp *http.Response, wait *time.Duration) {
+			waits = append(waits, *wait)
+			*wait = 0
+		}),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	doer.EXPECT().Do(req).Times(len(schedule)+1).Return(&http.Response{StatusCode: 500}, nil)
+	resp, err := client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, schedule, waits)
+
+	// connection errors follow the same schedule
+	waits = nil
+	doer.EXPECT().Do(req).Times(len(schedule)+1).Return(nil, someErr)
+	_, err = client.Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, schedule, waits)
+}
+
+func TestHttpClient_RetryableMethods(t *testing.T) {
+	ctx := context.TODO()
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+
+	// POST isn't retried by default
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 500}, nil)
+	resp, err := client.Post(ctx, "http://test.com", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// GET is retried
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 500}, nil)
+	_, err = client.Get(ctx, "http://test.com", nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	done()
+
+	// custom methods override the default
+	client, doer, done = newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithRetryableMethods(http.MethodPost),
+	)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 500}, nil)
+	_, err = client.Post(ctx, "http://test.com", nil, nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 500}, nil)
+	_, err = client.Get(ctx, "http://test.com", nil)
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_PathEscaping(t *testing.T) {
+	var uris []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uris = append(uris, r.RequestURI)
+	}))
+	defer server.Close()
+	ctx := context.TODO()
+
+	// pre-escaped segments are preserved
+	client, err := New(WithBaseURL(server.URL + "/api/"))
+	assert.Nil(t, err)
+	_, err = client.Get(ctx, "/items/a%2Fb?q=1", nil)
+	assert.Nil(t, err)
+
+	// raw segments are escaped
+	client, err = New(WithBaseURL(server.URL+"/api"), WithPathEscaping(true))
+	assert.Nil(t, err)
+	_, err = client.Get(ctx, "items/a b%2F?q=1", nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{
+		"/api/items/a%2Fb?q=1",
+		"/api/items/a%20b%252F?q=1",
+	}, uris)
+}
+
+func TestHttpClient_RetryBudget(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRetryCount(100),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 40 * time.Millisecond }),
+		WithRetryBudget(100*time.Millisecond),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	// the third wait would end past the budget
+	doer.EXPECT().Do(req).Times(3).Return(&http.Response{StatusCode: 503}, nil)
+	resp, err := client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, []time.Duration{40 * time.Millisecond, 40 * time.Millisecond}, clk.waits)
+
+	// the budget is counted from the start of every Do
+	clk.waits = nil
+	doer.EXPECT().Do(req).Times(3).Return(nil, someErr)
+	_, err = client.Do(req)
+	assert.Error(t, err)
+	assert.Equal(t, []time.Duration{40 * time.Millisecond, 40 * time.Millisecond}, clk.waits)
+}
+
+func TestHttpClient_RequestGetBody(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+	check := func(req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, payload, body)
+	}
+
+	// GetBody regenerates the body for every attempt
+	req, err := http.NewRequest(http.MethodPut, "https://google.com", bytes.NewReader(payload))
+	assert.Nil(t, err)
+	original := newTrackingBody(payload)
+	req.Body = original
+	getBody := req.GetBody
+	var getBodyCalls int
+	req.GetBody = func() (io.ReadCloser, error) {
+		getBodyCalls++
+		return getBody()
+	}
+	doer.EXPECT().Do(req).Times(3).Return(&http.Response{StatusCode: 500}, nil).Do(check)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, 0, original.read)
+	assert.Equal(t, 1, original.closed)
+	assert.True(t, getBodyCalls >= 3)
+
+	// bodies without GetBody are buffered
+	req, err = http.NewRequest(http.MethodPut, "https://google.com", io.MultiReader(bytes.NewReader(payload)))
+	assert.Nil(t, err)
+	assert.Nil(t, req.GetBody)
+	doer.EXPECT().Do(req).Times(3).Return(&http.Response{StatusCode: 500}, nil).Do(check)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+}
+
+func TestHttpClient_RetryOnlyIfBodyReplayable(t *testing.T) {
+	payload := []byte(`{"test":"test"}`)
+	newRequest := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPut, "https://google.com", io.MultiReader(bytes.NewReader(payload)))
+		assert.Nil(t, err)
+		return req
+	}
+	opts := []Option{
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithBodyBuffering(false),
+	}
+
+	// not retried silently
+	client, doer, done := newClient(t, opts...)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 500}, nil)
+	resp, err := client.Do(newRequest())
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	done()
+
+	// explicit error
+	client, doer, done = newClient(t, append(opts, WithRetryOnlyIfBodyReplayable())...)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 500}, nil)
+	resp, err = client.Do(newRequest())
+	assert.True(t, errors.Is(err, ErrBodyNotReplayable))
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// successful requests are not affected
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil)
+	_, err = client.Do(newRequest())
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_MaxRetryWait(t *testing.T) {
+	var waits []time.Duration
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return time.Hour }),
+		WithBackOffHook(func(attemptNum int, resp *http.Response, wait *time.Duration) {
+			waits = append(waits, *wait)
+			*wait = 2 * time.Hour
+		}),
+		WithMaxRetryWait(5*time.Millisecond),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(req).Times(3).Return(&http.Response{StatusCode: 503}, nil)
+	start := time.Now()
+	resp, err := client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, []time.Duration{5 * time.Millisecond, 5 * time.Millisecond}, waits)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestHttpClient_RetryProbe(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return time.Hour }),
+		WithRetryProbe("/health", time.Second),
+	)
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com/path?q=1", nil)
+	assert.Nil(t, err)
+
+	var paths []string
+	statuses := map[string][]int{"/path": {503, 200}, "/health": {200}}
+	doer.EXPECT().Do(gomock.Any()).Times(3).DoAndReturn(func(r *http.Request) (*http.Response, error) {
+		paths = append(paths, r.URL.RequestURI())
+		status := statuses[r.URL.Path][0]
+		statuses[r.URL.Path] = statuses[r.URL.Path][1:]
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	})
+	start := time.Now()
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"/path?q=1", "/health", "/path?q=1"}, paths)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestHttpClient_UserAgent(t *testing.T) {
+	client, doer, done := newClient(t, WithUserAgent("my-service/1.0"))
+	defer done()
+
+	// applied to requests without a user agent
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "my-service/1.0", req.Header.Get("User-Agent"))
+	})
+	_, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+
+	// an explicit user agent is preserved
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	req.Header.Set("User-Agent", "custom/2.0")
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "custom/2.0", req.Header.Get("User-Agent"))
+	})
+	_, err = client.Do(req)
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_Accept(t *testing.T) {
+	var accepts []string
+	record := func(req *http.Request) {
+		accepts = append(accepts, req.Header.Get("Accept"))
+	}
+
+	client, doer, done := newClient(t, WithAccept("application/json"))
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 200}, nil).Do(record)
+	_, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	// an explicit accept is preserved
+	_, err = client.Get(context.Background(), "https://google.com", http.Header{"Accept": {"text/csv"}})
+	assert.Nil(t, err)
+	done()
+
+	client, doer, done = newClient(t, WithAccept("application/json", " application/xml;q=0.9", "", "*/*;q=0.1"))
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(record)
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	done()
+
+	assert.Equal(t, []string{
+		"application/json",
+		"text/csv",
+		"application/json, application/xml;q=0.9, */*;q=0.1",
+	}, accepts)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestHttpClient_AttemptContext(t *testing.T) {
+	type attemptKey struct{}
+	var attempts []int
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempt := req.Context().Value(attemptKey{}).(int)
+		attempts = append(attempts, attempt)
+		status := http.StatusServiceUnavailable
+		if attempt == 2 {
+			status = http.StatusOK
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	})
+	cli, err := New(
+		WithTransport(transport),
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithAttemptContext(func(ctx context.Context, attempt int) context.Context {
+			return context.WithValue(ctx, attemptKey{}, attempt)
+		}),
+	)
+	assert.Nil(t, err)
+
+	resp, err := cli.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []int{0, 1, 2}, attempts)
+}
+
+func TestHttpClient_PerAttemptTimeout(t *testing.T) {
+	var attempts int
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+	cli, err := New(
+		WithDoer(doer),
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithPerAttemptTimeout(20*time.Millisecond),
+	)
+	assert.Nil(t, err)
+
+	start := time.Now()
+	resp, err := cli.Get(context.Background(), "https://google.com", nil)
+	// errors of earlier attempts are still reported
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, attempts)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestHttpClient_ContextDeadlineBoundsRetries(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return time.Hour }),
+	)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 503}, nil)
+	start := time.Now()
+	_, err := client.Get(ctx, "https://google.com", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestHttpClient_RetryStatusCodes(t *testing.T) {
+	noWait := WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 })
+	do := func(client Client) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+		assert.Nil(t, err)
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		return resp
+	}
+
+	client, doer, done := newClient(t, WithRetryCount(2), noWait,
+		WithRetryStatusCodes(http.StatusTooManyRequests, http.StatusRequestTimeout))
+	defer done()
+
+	// 429 is retried
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 429}, nil),
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	assert.Equal(t, http.StatusOK, do(client).StatusCode)
+
+	// 404 and 500 are not
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 404}, nil)
+	assert.Equal(t, http.StatusNotFound, do(client).StatusCode)
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 500}, nil)
+	assert.Equal(t, http.StatusInternalServerError, do(client).StatusCode)
+
+	// connection errors still are
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(nil, someErr)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	_, err = client.Do(req)
+	assert.Error(t, err)
+
+	// default policy without the option
+	client, doer, done = newClient(t, WithRetryCount(1), noWait)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 429}, nil)
+	assert.Equal(t, http.StatusTooManyRequests, do(client).StatusCode)
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 502}, nil)
+	req, err = http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	resp, err := client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestHttpClient_OnSuccess(t *testing.T) {
+	var calls int
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithOnSuccess(func(req *http.Request, resp *http.Response) {
+			calls++
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}),
+	)
+	defer done()
+
+	// fires once after retries succeed
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	_, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, calls)
+
+	// not on a final failure
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 503}, nil)
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(nil, someErr)
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestHttpClient_HostDefaultHeaders(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithDefaultHeaders(http.Header{"X-Team": {"ads"}}),
+		WithHostDefaultHeaders("A.example.com", http.Header{"X-Api-Key": {"key-a"}, "X-Team": {"host"}}),
+		WithHostDefaultHeaders("b.example.com:8443", http.Header{"X-Api-Key": {"key-b"}}),
+	)
+	defer done()
+	expect := func(apiKey, team string) {
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+			assert.Equal(t, apiKey, req.Header.Get("X-Api-Key"))
+			assert.Equal(t, team, req.Header.Get("X-Team"))
+		})
+	}
+
+	expect("key-a", "ads")
+	_, err := client.Get(context.Background(), "https://a.example.com/path", nil)
+	assert.Nil(t, err)
+
+	expect("", "ads")
+	_, err = client.Get(context.Background(), "https://c.example.com/path", nil)
+	assert.Nil(t, err)
+
+	expect("key-b", "ads")
+	_, err = client.Get(context.Background(), "https://b.example.com:8443/path", nil)
+	assert.Nil(t, err)
+
+	// per call headers win
+	expect("own", "ads")
+	_, err = client.Get(context.Background(), "https://a.example.com/path", http.Header{"X-Api-Key": {"own"}})
+	assert.Nil(t, err)
+}
+
+func TestHttpClient_MultipleHooks(t *testing.T) {
+	var calls []string
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithRequestHook(func(req *http.Request, retry int) {
+			calls = append(calls, "log:"+strconv.Itoa(retry))
+		}),
+		WithRequestHook(func(req *http.Request, retry int) {
+			calls = append(calls, "metrics:"+strconv.Itoa(retry))
+		}),
+		WithResponseHook(func(req *http.Request, resp *http.Response) {
+			calls = append(calls, "resp1")
+		}),
+		WithResponseHook(func(req *http.Request, resp *http.Response) {
+			calls = append(calls, "resp2")
+		}),
+		WithErrorHook(func(req *http.Request, err error, retry int) {
+			calls = append(calls, "err1")
+		}),
+		WithErrorHook(func(req *http.Request, err error, retry int) {
+			calls = append(calls, "err2")
+		}),
+	)
+	defer done()
+
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	_, _ = client.Get(context.Background(), "https://google.com", nil)
+	assert.Equal(t, []string{
+		"log:0", "metrics:0", "err1", "err2",
+		"log:1", "metrics:1", "resp1", "resp2",
+		"log:2", "metrics:2", "resp1", "resp2",
+	}, calls)
+}
+
+func TestHttpClient_TimeoutFromHeader(t *testing.T) {
+	client, doer, done := newClient(t, WithTimeoutFromHeader("X-Request-Timeout"))
+	defer done()
+
+	var deadlines []time.Duration
+	doer.EXPECT().Do(gomock.Any()).Times(4).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		var left time.Duration
+		if deadline, ok := req.Context().Deadline(); ok {
+			left = time.Until(deadline)
+		}
+		deadlines = append(deadlines, left)
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+
+	for _, value := range []string{"2s", "1500", "bogus"} {
+		resp, err := client.Get(context.Background(), "https://google.com", http.Header{"X-Request-Timeout": {value}})
+		assert.Nil(t, err)
+		assert.Nil(t, resp.Body.Close())
+	}
+	// a deadline set by the caller wins over the header
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_, err := client.Get(ctx, "https://google.com", http.Header{"X-Request-Timeout": {"2s"}})
+	assert.Nil(t, err)
+
+	assert.True(t, deadlines[0] > time.Second && deadlines[0] <= 2*time.Second)
+	assert.True(t, deadlines[1] > time.Second && deadlines[1] <= 1500*time.Millisecond)
+	assert.Equal(t, time.Duration(0), deadlines[2])
+	assert.True(t, deadlines[3] > time.Minute)
+}
+
+func TestHttpClient_OnStatusChange(t *testing.T) {
+	var transitions [][3]int
+	client, doer, done := newClient(t,
+		WithRetryCount(4),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithOnStatusChange(func(from, to int, attempt int) {
+			transitions = append(transitions, [3]int{from, to, attempt})
+		}),
+	)
+	defer done()
+
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, [][3]int{{503, 500, 2}, {500, 200, 3}}, transitions)
+}
+
+func TestHttpClient_ConnectionReuse(t *testing.T) {
+	var mu sync.Mutex
+	var newConns, calls int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		calls++
+		retry := calls%2 == 1
+		mu.Unlock()
+		if retry {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("try again"))
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			newConns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	connections := func(opts ...Option) int {
+		mu.Lock()
+		newConns, calls = 0, 0
+		mu.Unlock()
+		cli, err := New(append([]Option{
+			WithTransport(&http.Transport{}),
+			WithRetryCount(1),
+			WithRetryableMethods(http.MethodPost),
+			WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		}, opts...)...)
+		assert.Nil(t, err)
+		for i := 0; i < 3; i++ {
+			resp, err := cli.Post(context.Background(), server.URL, strings.NewReader("payload"), nil)
+			assert.Nil(t, err)
+			body, err := ReadBodyString(resp)
+			assert.Nil(t, err)
+			assert.Equal(t, "payload", body)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return newConns
+	}
+	assert.Equal(t, 1, connections())
+	assert.Equal(t, 6, connections(WithForceClose()))
+}
+
+func TestHttpClient_NoRetryContext(t *testing.T) {
+	var checked int
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithRetryableMethods(http.MethodPost),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			checked++
+			return true, nil
+		}),
+	)
+	defer done()
+
+	ctx := WithNoRetry(context.Background())
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 503}, nil)
+	resp, err := client.Post(ctx, "https://google.com", strings.NewReader("charge"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 0, checked)
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(nil, someErr)
+	_, err = client.Post(ctx, "https://google.com", strings.NewReader("charge"), nil)
+	assert.True(t, errors.Is(err, someErr))
+	// CheckRetry still sees connection errors, as on the last attempt
+	assert.Equal(t, 1, checked)
+
+	// other calls are still retried
+	doer.EXPECT().Do(gomock.Any()).Times(4).Return(&http.Response{StatusCode: 503}, nil)
+	_, err = client.Post(context.Background(), "https://google.com", strings.NewReader("charge"), nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	// CheckRetry decides on the last attempt as well
+	assert.Equal(t, 5, checked)
+}
@@ -0,0 +1,77 @@
+package httpclient
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencySummary describes the latencies of the most recent attempts.
+type LatencySummary struct {
+	Count int
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// latencyReservoir keeps the latencies of the last attempts in a ring.
+type latencyReservoir struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyReservoir(size int) *latencyReservoir {
+	return &latencyReservoir{samples: make([]time.Duration, size)}
+}
+
+func (r *latencyReservoir) observe(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples[r.next] = d
+	r.next++
+	if r.next == len(r.samples) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+func (r *latencyReservoir) summary() LatencySummary {
+	r.mu.Lock()
+	n := r.next
+	if r.full {
+		n = len(r.samples)
+	}
+	sorted := append([]time.Duration(nil), r.samples[:n]...)
+	r.mu.Unlock()
+	if n == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return LatencySummary{
+		Count: n,
+		P50:   percentile(sorted, 0.50),
+		P95:   percentile(sorted, 0.95),
+		P99:   percentile(sorted, 0.99),
+	}
+}
+
+// percentile returns the nearest rank percentile of the sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// LatencySummary returns the p50/p95/p99 latencies of the most recent
+// attempts tracked with WithLatencyTracking, or a zero summary without it.
+func (c *HttpClient) LatencySummary() LatencySummary {
+	if c.latency == nil {
+		return LatencySummary{}
+	}
+	return c.latency.summary()
+}
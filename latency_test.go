@@ -0,0 +1,48 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_LatencySummary(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	var latency time.Duration
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		clk.now = clk.now.Add(latency)
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+	cli, err := New(WithDoer(doer), withClock(clk), WithLatencyTracking(100))
+	assert.Nil(t, err)
+	assert.Equal(t, LatencySummary{}, cli.LatencySummary())
+
+	// the first samples are pushed out of the reservoir
+	for i := 1; i <= 150; i++ {
+		latency = time.Hour
+		if i > 50 {
+			latency = time.Duration(i-50) * time.Millisecond
+		}
+		_, err := cli.Get(context.Background(), "https://google.com", nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, LatencySummary{
+		Count: 100,
+		P50:   50 * time.Millisecond,
+		P95:   95 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}, cli.LatencySummary())
+}
+
+func TestHttpClient_LatencySummaryDisabled(t *testing.T) {
+	client, doer, done := newClient(t)
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil)
+	_, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, LatencySummary{}, client.LatencySummary())
+}
@@ -0,0 +1,79 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Logger receives the log lines written by the client.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+const redacted = "[REDACTED]"
+
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// logAttempt logs the outcome of a single attempt.
+func (c *HttpClient) logAttempt(req *http.Request, resp *http.Response, err error, attempt int, duration time.Duration) {
+	if err != nil {
+		c.logger.Errorf("%s %s attempt=%d duration=%s headers=%s error=%v",
+			req.Method, logURL(req.URL), attempt, duration, c.formatHeaders(req.Header), err)
+		return
+	}
+	c.logger.Debugf("%s %s attempt=%d status=%d duration=%s headers=%s",
+		req.Method, logURL(req.URL), attempt, resp.StatusCode, duration, c.formatHeaders(req.Header))
+}
+
+// logRetry logs a retry scheduled after the given attempt.
+func (c *HttpClient) logRetry(req *http.Request, attempt int, wait time.Duration) {
+	c.logger.Debugf("%s %s retry after attempt=%d wait=%s", req.Method, logURL(req.URL), attempt, wait)
+}
+
+// logURL renders the URL without the userinfo, query and fragment, which
+// may carry credentials or tokens.
+func logURL(u *url.URL) string {
+	logged := url.URL{Scheme: u.Scheme, Opaque: u.Opaque, Host: u.Host, Path: u.Path, RawPath: u.RawPath}
+	return logged.String()
+}
+
+// formatHeaders renders the headers with sensitive values redacted.
+func (c *HttpClient) formatHeaders(h http.Header) string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(h[key], ",")
+		if c.isRedacted(key) {
+			value = redacted
+		}
+		parts = append(parts, key+": "+value)
+	}
+	return "{" + strings.Join(parts, "; ") + "}"
+}
+
+func (c *HttpClient) isRedacted(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	if c.logAllowedHeaders[key] {
+		return false
+	}
+	for _, name := range defaultRedactedHeaders {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
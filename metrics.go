@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// MetricsCollector receives the outcome of every attempt and every retry.
+// The status is 0 when the attempt failed with a connection error.
+type MetricsCollector interface {
+	ObserveRequest(method, host string, status int, duration time.Duration)
+	IncRetry(method, host string)
+}
+
+// RetryThrottleObserver is implemented by a MetricsCollector which wants to
+// know, for every retry weighed against the WithRetryBudget limit, whether
+// the budget throttled it.
+type RetryThrottleObserver interface {
+	ObserveRetryThrottle(throttled bool)
+}
+
+// observeRetryThrottle reports the decision to the collector if it
+// implements RetryThrottleObserver.
+func (c *HttpClient) observeRetryThrottle(throttled bool) {
+	if observer, ok := c.metrics.(RetryThrottleObserver); ok {
+		observer.ObserveRetryThrottle(throttled)
+	}
+}
+
+// observeRequest reports a call to the Doer to the metrics collector and
+// the latency reservoir.
+func (c *HttpClient) observeRequest(req *http.Request, resp *http.Response, duration time.Duration) {
+	if c.latency != nil {
+		c.latency.observe(duration)
+	}
+	if c.metrics != nil {
+		var status int
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		c.metrics.ObserveRequest(req.Method, req.URL.Host, status, duration)
+	}
+}
+
+// observeDoer wraps the doer so every call to it is observed, including
+// the extra calls made by hedging and probing.
+func (c *HttpClient) observeDoer(doer Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		start := c.clock.Now()
+		resp, err := doer.Do(req)
+		c.observeRequest(req, resp, c.clock.Now().Sub(start))
+		return resp, err
+	})
+}
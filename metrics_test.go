@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type observation struct {
+	method string
+	host   string
+	status int
+}
+
+type fakeCollector struct {
+	requests []observation
+	retries  []observation
+}
+
+func (f *fakeCollector) ObserveRequest(method, host string, status int, duration time.Duration) {
+	f.requests = append(f.requests, observation{method: method, host: host, status: status})
+}
+
+func (f *fakeCollector) IncRetry(method, host string) {
+	f.retries = append(f.retries, observation{method: method, host: host})
+}
+
+func TestHttpClient_Metrics(t *testing.T) {
+	collector := &fakeCollector{}
+	client, doer, done := newClient(t,
+		WithRetryCount(2),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithMetrics(collector),
+	)
+	defer done()
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 502}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	_, err := client.Get(context.TODO(), "http://test.com/path", nil)
+	assert.Error(t, err)
+
+	assert.Equal(t, []observation{
+		{method: http.MethodGet, host: "test.com", status: 0},
+		{method: http.MethodGet, host: "test.com", status: 502},
+		{method: http.MethodGet, host: "test.com", status: 200},
+	}, collector.requests)
+	assert.Equal(t, []observation{
+		{method: http.MethodGet, host: "test.com"},
+		{method: http.MethodGet, host: "test.com"},
+	}, collector.retries)
+}
+
+type throttleCollector struct {
+	fakeCollector
+	throttles []bool
+}
+
+func (f *throttleCollector) ObserveRetryThrottle(throttled bool) {
+	f.throttles = append(f.throttles, throttled)
+}
+
+func TestHttpClient_MetricsRetryThrottle(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	collector := &throttleCollector{}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRetryCount(10),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 100 * time.Millisecond }),
+		WithRetryBudget(250*time.Millisecond),
+		WithMetrics(collector),
+	)
+	defer done()
+
+	doer.EXPECT().Do(gomock.Any()).Times(3).Return(&http.Response{StatusCode: 503}, nil)
+	_, err := client.Get(context.TODO(), "http://test.com/path", nil)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, []bool{false, false, true}, collector.throttles)
+	assert.Len(t, collector.retries, 2)
+}
+
+func TestHttpClient_ObservableDoer(t *testing.T) {
+	collector := &fakeCollector{}
+	// The middleware retries on its own, out of sight of the attempt loop.
+	retryOnce := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if resp, err := next.Do(req); err == nil {
+				return resp, nil
+			}
+			return next.Do(req)
+		})
+	}
+	client, doer, done := newClient(t,
+		WithMetrics(collector),
+		WithMiddleware(retryOnce),
+		WithObservableDoer(),
+	)
+	defer done()
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	resp, err := client.Get(context.TODO(), "http://test.com/path", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	assert.Equal(t, []observation{
+		{method: http.MethodGet, host: "test.com", status: 0},
+		{method: http.MethodGet, host: "test.com", status: 200},
+	}, collector.requests)
+}
@@ -0,0 +1,41 @@
+package httpclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DoerFunc is an adapter to allow the use of ordinary functions as Doer.
+type DoerFunc func(*http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps a Doer to add cross-cutting behavior such as signing,
+// logging or header injection. Middlewares wrap the underlying Doer, so
+// they run once per attempt, inside the retry loop.
+type Middleware func(next Doer) Doer
+
+// chain wraps the doer so the first middleware sees the request first.
+func chain(doer Doer, middlewares []Middleware) Doer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		doer = middlewares[i](doer)
+	}
+	return doer
+}
+
+// methodMiddleware applies the middleware only to requests with the method.
+func methodMiddleware(method string, m Middleware) Middleware {
+	method = strings.ToUpper(method)
+	return func(next Doer) Doer {
+		wrapped := m(next)
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == method {
+				return wrapped.Do(req)
+			}
+			return next.Do(req)
+		})
+	}
+}
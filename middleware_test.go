@@ -0,0 +1,87 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_Middleware(t *testing.T) {
+	var order []string
+	counts := make(map[string]int)
+	middleware := func(name string) Middleware {
+		return func(next Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				counts[name]++
+				req.Header.Add("X-Middleware", name)
+				return next.Do(req)
+			})
+		}
+	}
+	client, doer, done := newClient(t,
+		WithMiddleware(middleware("outer"), middleware("inner")),
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	defer done()
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500}, nil).Do(func(req *http.Request) {
+			assert.Equal(t, []string{"outer", "inner"}, req.Header.Values("X-Middleware"))
+		}),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	_, err := client.Get(context.TODO(), "http://test.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"outer", "inner", "outer", "inner"}, order)
+	assert.Equal(t, map[string]int{"outer": 2, "inner": 2}, counts)
+}
+
+func TestHttpClient_MethodMiddleware(t *testing.T) {
+	var signed []string
+	sign := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			signed = append(signed, req.Method)
+			req.Header.Set("X-Signature", "signed")
+			return next.Do(req)
+		})
+	}
+	client, doer, done := newClient(t, WithMethodMiddleware("post", sign))
+	defer done()
+
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "signed", req.Header.Get("X-Signature"))
+	})
+	_, err := client.Post(context.TODO(), "http://test.com", nil, nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Empty(t, req.Header.Get("X-Signature"))
+	})
+	_, err = client.Get(context.TODO(), "http://test.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{http.MethodPost}, signed)
+}
+
+func TestHttpClient_DoerForScheme(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	internal := NewMockDoer(ctrl)
+	client, doer, done := newClient(t, WithDoerForScheme("INTERNAL", internal))
+	defer done()
+
+	internal.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "internal", req.URL.Scheme)
+		assert.Equal(t, "service", req.URL.Host)
+	})
+	_, err := client.Get(context.TODO(), "internal://service/path", nil)
+	assert.Nil(t, err)
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200}, nil)
+	_, err = client.Get(context.TODO(), "https://google.com", nil)
+	assert.Nil(t, err)
+}
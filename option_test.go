@@ -1,11 +1,24 @@
 package httpclient
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
 	"time"
 
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,3 +36,370 @@ func TestOptions(t *testing.T) {
 		runtime.FuncForPC(reflect.ValueOf(defaultBackOffPolicy).Pointer()).Name(),
 	)
 }
+
+func TestNew_Validate(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"retry count":            WithRetryCount(-1),
+		"timeout":                WithTimeout(-time.Second),
+		"retry budget":           WithRetryBudget(-time.Second),
+		"dial timeout":           WithDialTimeout(-time.Second),
+		"tls handshake timeout":  WithTLSHandshakeTimeout(-time.Second),
+		"body capture size":      WithResponseBodyCapture(-1, nil),
+		"max request body size":  WithMaxRequestBodySize(-1),
+		"max response body size": WithMaxResponseBodySize(-1),
+		"zero rate limit":        WithRateLimiter(NewRateLimiter(0, 1)),
+		"negative rate limit":    WithRateLimiter(NewRateLimiter(-1, 1)),
+	} {
+		cli, err := New(opt)
+		assert.True(t, errors.Is(err, ErrInvalidOption), name)
+		assert.Nil(t, cli, name)
+	}
+
+	cli, err := New(WithRetryCount(0), WithTimeout(time.Second), WithRetryBudget(0))
+	assert.Nil(t, err)
+	assert.NotNil(t, cli)
+}
+
+func TestWithHostDialTimeout(t *testing.T) {
+	cli, err := New(
+		WithHostDialTimeout("a.example.com", time.Second),
+		WithHostDialTimeout("b.example.com", 3*time.Second),
+	)
+	assert.Nil(t, err)
+	httpcli, ok := cli.(*HttpClient)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, httpcli.hostDialTimeout("a.example.com:443"))
+	assert.Equal(t, 3*time.Second, httpcli.hostDialTimeout("b.example.com:80"))
+	assert.Equal(t, DefaultDialTimeout, httpcli.hostDialTimeout("c.example.com:80"))
+
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.NotNil(t, transport.DialContext)
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpclient")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "api.sock")
+	listener, err := net.Listen("unix", socket)
+	assert.Nil(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Host + r.URL.Path))
+	})}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	cli, err := New(WithUnixSocket(socket), WithTimeout(5*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, stdClient(t, cli).Timeout)
+	resp, err := cli.Get(context.Background(), "http://unix/v1/containers", nil)
+	assert.Nil(t, err)
+	body, err := ReadBodyString(resp)
+	assert.Nil(t, err)
+	assert.Equal(t, "unix/v1/containers", body)
+}
+
+func TestWithDialTimeout(t *testing.T) {
+	cli, err := New(WithDialTimeout(time.Second), WithTLSHandshakeTimeout(2*time.Second))
+	assert.Nil(t, err)
+	httpcli, ok := cli.(*HttpClient)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, httpcli.hostDialTimeout("a.example.com:443"))
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.NotNil(t, transport.DialContext)
+	assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+
+	// a non-routable address fails within the dial timeout
+	cli, err = New(WithDialTimeout(100*time.Millisecond), WithTimeout(time.Minute))
+	assert.Nil(t, err)
+	start := time.Now()
+	_, err = cli.Get(context.Background(), "http://10.255.255.1:81", nil)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestDefaultTransportCloned(t *testing.T) {
+	shared := &http.Transport{}
+	base, err := New(WithTransport(shared), WithHostDialTimeout("a.example.com", time.Second))
+	assert.Nil(t, err)
+	baseTransport := stdClient(t, base).Transport.(*http.Transport)
+	assert.NotEqual(t, fmt.Sprintf("%p", shared), fmt.Sprintf("%p", baseTransport))
+	assert.Nil(t, shared.DialContext)
+	assert.NotNil(t, baseTransport.DialContext)
+	baseDial := reflect.ValueOf(baseTransport.DialContext).Pointer()
+
+	derived, err := base.With(WithDialTimeout(2*time.Second), WithUnixSocket("/tmp/api.sock"))
+	assert.Nil(t, err)
+	derivedTransport := stdClient(t, derived).Transport.(*http.Transport)
+	assert.NotEqual(t, fmt.Sprintf("%p", baseTransport), fmt.Sprintf("%p", derivedTransport))
+	assert.Nil(t, shared.DialContext)
+	assert.Equal(t, baseDial, reflect.ValueOf(baseTransport.DialContext).Pointer())
+	assert.Equal(t, DefaultDialTimeout, base.(*HttpClient).hostDialTimeout("b.example.com:80"))
+	assert.Equal(t, "", base.(*HttpClient).unixSocket)
+}
+
+func stdClient(t *testing.T, cli Client) *http.Client {
+	httpcli, ok := cli.(*HttpClient)
+	assert.True(t, ok)
+	stdcli, ok := httpcli.client.(*http.Client)
+	assert.True(t, ok)
+	return stdcli
+}
+
+func TestWithTransport(t *testing.T) {
+	transport := &http.Transport{}
+	cli, err := New(WithTransport(transport), WithTimeout(time.Second))
+	assert.Nil(t, err)
+	stdcli := stdClient(t, cli)
+	assert.Equal(t, transport, stdcli.Transport)
+	assert.Equal(t, time.Second, stdcli.Timeout)
+}
+
+func TestWithConnectionPool(t *testing.T) {
+	cli, err := New(WithConnectionPool(50, 5, time.Minute), WithTimeout(time.Second))
+	assert.Nil(t, err)
+	stdcli := stdClient(t, cli)
+	transport, ok := stdcli.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 50, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.Equal(t, time.Second, stdcli.Timeout)
+
+	// pool settings are applied to a clone of a custom transport
+	custom := &http.Transport{MaxIdleConns: 7, ForceAttemptHTTP2: true}
+	cli, err = New(WithTransport(custom), WithConnectionPool(1, 5, time.Minute))
+	assert.Nil(t, err)
+	transport, ok = stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 1, transport.MaxIdleConns)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Equal(t, 7, custom.MaxIdleConns)
+	assert.Equal(t, 0, custom.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Duration(0), custom.IdleConnTimeout)
+}
+
+func TestWithDisableKeepAlives(t *testing.T) {
+	cli, err := New(WithConnectionPool(50, 5, time.Minute), WithDisableKeepAlives())
+	assert.Nil(t, err)
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+
+	// a transport set afterwards wins
+	custom := &http.Transport{}
+	cli, err = New(WithDisableKeepAlives(), WithTransport(custom))
+	assert.Nil(t, err)
+	assert.Equal(t, custom, stdClient(t, cli).Transport)
+	assert.False(t, custom.DisableKeepAlives)
+
+	// a custom transport is cloned before keep-alives are disabled
+	cli, err = New(WithTransport(custom), WithDisableKeepAlives())
+	assert.Nil(t, err)
+	transport, ok = stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.DisableKeepAlives)
+	assert.False(t, custom.DisableKeepAlives)
+}
+
+func TestWithResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cli, err := New(WithResponseHeaderTimeout(50 * time.Millisecond))
+	assert.Nil(t, err)
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Millisecond, transport.ResponseHeaderTimeout)
+
+	started := time.Now()
+	resp, err := cli.Get(context.Background(), server.URL, nil)
+	assert.Nil(t, resp)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+	assert.True(t, time.Since(started) < time.Second)
+}
+
+func TestWithProxy(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	assert.Nil(t, err)
+
+	cli, err := New(WithProxy("http://proxy.local:3128"))
+	assert.Nil(t, err)
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	proxyURL, err := transport.Proxy(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://proxy.local:3128", proxyURL.String())
+
+	// last applied wins
+	custom := &http.Transport{}
+	cli, err = New(WithProxy("http://proxy.local:3128"), WithTransport(custom))
+	assert.Nil(t, err)
+	assert.Equal(t, custom, stdClient(t, cli).Transport)
+	assert.Nil(t, custom.Proxy)
+
+	cli, err = New(WithTransport(custom), WithProxy("http://other.local:8080"))
+	assert.Nil(t, err)
+	transport, ok = stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	proxyURL, err = transport.Proxy(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://other.local:8080", proxyURL.String())
+	assert.Nil(t, custom.Proxy)
+
+	cli, err = New(WithTransport(custom), WithProxyFromEnvironment())
+	assert.Nil(t, err)
+	assert.NotNil(t, stdClient(t, cli).Transport.(*http.Transport).Proxy)
+	assert.Nil(t, custom.Proxy)
+
+	// invalid url
+	cli, err = New(WithProxy("://bad"))
+	assert.Error(t, err)
+	assert.Nil(t, cli)
+	_, err = New(WithProxy("proxy.local"))
+	assert.Error(t, err)
+}
+
+func TestWithProxyFromEnvironment(t *testing.T) {
+	cli, err := New(WithProxyFromEnvironment())
+	assert.Nil(t, err)
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t,
+		runtime.FuncForPC(reflect.ValueOf(http.ProxyFromEnvironment).Pointer()).Name(),
+		runtime.FuncForPC(reflect.ValueOf(transport.Proxy).Pointer()).Name(),
+	)
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	cfg := &tls.Config{ServerName: "internal"}
+	pool := x509.NewCertPool()
+	cli, err := New(
+		WithProxy("http://proxy.local:3128"),
+		WithTLSConfig(cfg),
+		WithRootCAs(pool),
+		WithConnectionPool(10, 2, time.Minute),
+	)
+	assert.Nil(t, err)
+	transport, ok := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, pool, transport.TLSClientConfig.RootCAs)
+	assert.Nil(t, cfg.RootCAs)
+	assert.Equal(t, "internal", transport.TLSClientConfig.ServerName)
+	assert.NotNil(t, transport.Proxy)
+	assert.Equal(t, 2, transport.MaxIdleConnsPerHost)
+
+	cli, err = New(WithInsecureSkipVerify())
+	assert.Nil(t, err)
+	transport, ok = stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+}
+
+func TestWithTLSConfig_CallerObjectsUntouched(t *testing.T) {
+	cfg := &tls.Config{ServerName: "internal"}
+	custom := &http.Transport{TLSClientConfig: cfg}
+	cli, err := New(WithTransport(custom), WithInsecureSkipVerify(), WithRootCAs(x509.NewCertPool()))
+	assert.Nil(t, err)
+	transport := stdClient(t, cli).Transport.(*http.Transport)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, "internal", transport.TLSClientConfig.ServerName)
+	assert.False(t, cfg.InsecureSkipVerify)
+	assert.Nil(t, cfg.RootCAs)
+	assert.Equal(t, cfg, custom.TLSClientConfig)
+
+	shared := http.DefaultTransport.(*http.Transport)
+	before := shared.TLSClientConfig
+	cli, err = New(WithTransport(shared), WithInsecureSkipVerify())
+	assert.Nil(t, err)
+	assert.True(t, stdClient(t, cli).Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	assert.Equal(t, before, shared.TLSClientConfig)
+	if shared.TLSClientConfig != nil {
+		assert.False(t, shared.TLSClientConfig.InsecureSkipVerify)
+	}
+
+	cfg = &tls.Config{}
+	cli, err = New(WithTLSConfig(cfg), WithInsecureSkipVerify())
+	assert.Nil(t, err)
+	assert.True(t, stdClient(t, cli).Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	assert.False(t, cfg.InsecureSkipVerify)
+}
+
+func TestHttpClient_With(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	doer := NewMockDoer(ctrl)
+	base, err := New(
+		WithDoer(doer),
+		WithBaseURL("https://base.example.com"),
+		WithDefaultHeaders(http.Header{"X-Base": {"1"}}),
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+	)
+	assert.Nil(t, err)
+	derived, err := base.With(
+		WithBaseURL("https://other.example.com"),
+		WithDefaultHeaders(http.Header{"X-Extra": {"2"}}),
+	)
+	assert.Nil(t, err)
+
+	// the derived client inherits the base settings
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+			assert.Equal(t, "other.example.com", req.URL.Host)
+			assert.Equal(t, "1", req.Header.Get("X-Base"))
+			assert.Equal(t, "2", req.Header.Get("X-Extra"))
+		}),
+	)
+	_, err = derived.Get(context.Background(), "/path", nil)
+	assert.Nil(t, err)
+
+	// the base client is unaffected
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(func(req *http.Request) {
+		assert.Equal(t, "base.example.com", req.URL.Host)
+		assert.Empty(t, req.Header.Get("X-Extra"))
+	})
+	_, err = base.Get(context.Background(), "/path", nil)
+	assert.Nil(t, err)
+
+	derived.(*HttpClient).defaultHeaders.Set("X-Base", "changed")
+	assert.Equal(t, "1", base.(*HttpClient).defaultHeaders.Get("X-Base"))
+
+	// invalid options are reported
+	_, err = base.With(WithRetryCount(-1))
+	assert.True(t, errors.Is(err, ErrInvalidOption))
+}
+
+func TestHttpClient_WithBaseUnchanged(t *testing.T) {
+	shared := &http.Client{Timeout: time.Minute}
+	base, err := New(
+		WithDoer(shared),
+		WithTimeout(time.Second),
+		WithRandSource(rand.NewSource(1)),
+		WithGetResultCache(time.Minute),
+	)
+	assert.Nil(t, err)
+	derived, err := base.With(WithTimeout(time.Hour))
+	assert.Nil(t, err)
+
+	// the caller's http client is copied, never modified
+	assert.Equal(t, time.Minute, shared.Timeout)
+	assert.Equal(t, time.Second, stdClient(t, base).Timeout)
+	assert.Equal(t, time.Hour, stdClient(t, derived).Timeout)
+
+	// the rand source is shared behind a single lock
+	assert.Equal(t, fmt.Sprintf("%p", base.(*HttpClient).rand), fmt.Sprintf("%p", derived.(*HttpClient).rand))
+
+	// every client gets its own result cache
+	assert.NotEqual(t, fmt.Sprintf("%p", base.(*HttpClient).cache), fmt.Sprintf("%p", derived.(*HttpClient).cache))
+}
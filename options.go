@@ -1,7 +1,17 @@
 package httpclient
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 type Option func(client *HttpClient)
@@ -27,15 +37,21 @@ func WithRetryCount(retryCount int) Option {
 	}
 }
 
+// WithRequestHook adds a hook, hooks run in the order they were added.
 func WithRequestHook(rh RequestHook) Option {
 	return func(c *HttpClient) {
-		c.requestHook = rh
+		if rh != nil {
+			c.requestHooks = append(c.requestHooks, rh)
+		}
 	}
 }
 
+// WithResponseHook adds a hook, hooks run in the order they were added.
 func WithResponseHook(rh ResponseHook) Option {
 	return func(c *HttpClient) {
-		c.responseHook = rh
+		if rh != nil {
+			c.responseHooks = append(c.responseHooks, rh)
+		}
 	}
 }
 
@@ -54,13 +70,36 @@ func WithBackOff(b BackOff) Option {
 	}
 }
 
+// WithBackOffHook sets the hook called before each back off sleep.
+func WithBackOffHook(h BackOffHook) Option {
+	return func(c *HttpClient) {
+		c.backOffHook = h
+	}
+}
+
+// WithErrorHook adds a hook, hooks run in the order they were added.
 func WithErrorHook(eh ErrorHook) Option {
 	return func(c *HttpClient) {
-		c.errorHook = eh
+		if eh != nil {
+			c.errorHooks = append(c.errorHooks, eh)
+		}
 	}
 }
 
 func WithErrorHandler(eh ErrorHandler) Option {
+	return func(c *HttpClient) {
+		if eh == nil {
+			c.errorHandler = nil
+			return
+		}
+		c.errorHandler = eh.withRequest()
+	}
+}
+
+// WithRequestErrorHandler sets the error handler like WithErrorHandler,
+// passing it the request and its context as well. The last of the two
+// options wins.
+func WithRequestErrorHandler(eh RequestErrorHandler) Option {
 	return func(c *HttpClient) {
 		c.errorHandler = eh
 	}
@@ -71,3 +110,830 @@ func WithBaseURL(u string) Option {
 		c.baseURL = u
 	}
 }
+
+// WithDefaultHeaders sets headers which are added to every request.
+// Headers passed per call win on conflict.
+func WithDefaultHeaders(h http.Header) Option {
+	return func(c *HttpClient) {
+		if c.defaultHeaders == nil {
+			c.defaultHeaders = make(http.Header)
+		}
+		for key, values := range h {
+			c.defaultHeaders.Del(key)
+			for _, v := range values {
+				c.defaultHeaders.Add(key, v)
+			}
+		}
+	}
+}
+
+// WithHostDefaultHeaders sets headers added to requests for the host,
+// given with or without a port, which carry neither the header nor a
+// default header set with WithDefaultHeaders.
+func WithHostDefaultHeaders(host string, h http.Header) Option {
+	return func(c *HttpClient) {
+		if c.hostHeaders == nil {
+			c.hostHeaders = make(map[string]http.Header)
+		}
+		host = strings.ToLower(host)
+		headers := c.hostHeaders[host]
+		if headers == nil {
+			headers = make(http.Header)
+			c.hostHeaders[host] = headers
+		}
+		for key, values := range h {
+			headers.Del(key)
+			for _, v := range values {
+				headers.Add(key, v)
+			}
+		}
+	}
+}
+
+// WithVerifyContentDigest verifies the response body against the
+// Content-MD5 or Digest header when the server provides one.
+func WithVerifyContentDigest() Option {
+	return func(c *HttpClient) {
+		c.verifyDigest = true
+	}
+}
+
+// WithDialTimeout sets the connect timeout of the default http client,
+// DefaultDialTimeout by default. It has no effect when a custom Doer is used.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *HttpClient) {
+		c.dialTimeout = d
+		c.defaultTransport().DialContext = c.dialContext
+	}
+}
+
+// WithTLSHandshakeTimeout limits the time spent on the TLS handshake by
+// the default http client, independently of WithTimeout. It has no effect
+// when a custom Doer is used.
+func WithTLSHandshakeTimeout(d time.Duration) Option {
+	return func(c *HttpClient) {
+		if d < 0 {
+			c.setErr(errors.Wrapf(ErrInvalidOption, "tls handshake timeout %s", d))
+			return
+		}
+		c.defaultTransport().TLSHandshakeTimeout = d
+	}
+}
+
+// WithHostDialTimeout sets the connect timeout for the given host of the
+// default http client, overriding the global dial timeout.
+func WithHostDialTimeout(host string, timeout time.Duration) Option {
+	return func(c *HttpClient) {
+		if c.hostDialTimeouts == nil {
+			c.hostDialTimeouts = make(map[string]time.Duration)
+		}
+		c.hostDialTimeouts[host] = timeout
+		c.defaultTransport().DialContext = c.dialContext
+	}
+}
+
+// WithUnixSocket makes the default http client connect to the Unix socket
+// at path whatever the host of the URL, e.g. http://unix/v1/containers.
+// The dial and request timeouts still apply. It has no effect on a Doer
+// set with WithDoer.
+func WithUnixSocket(path string) Option {
+	return func(c *HttpClient) {
+		c.unixSocket = path
+		c.defaultTransport().DialContext = c.dialContext
+	}
+}
+
+// WithBearerToken sets the bearer token authorization on every request
+// which does not carry its own Authorization header.
+func WithBearerToken(token string) Option {
+	return func(c *HttpClient) {
+		c.authorization = "Bearer " + token
+	}
+}
+
+// WithBasicAuth sets the basic authorization on every request
+// which does not carry its own Authorization header.
+func WithBasicAuth(username, password string) Option {
+	return func(c *HttpClient) {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		c.authorization = "Basic " + credentials
+	}
+}
+
+// WithResponseBodyDiscardOnRetry controls whether the body of a retried
+// response is drained before it is closed. Draining is enabled by default.
+func WithResponseBodyDiscardOnRetry(discard bool) Option {
+	return func(c *HttpClient) {
+		c.keepRetryBody = !discard
+	}
+}
+
+// WithFailureHook sets the hook called on connection errors and on
+// responses which trigger a retry.
+func WithFailureHook(fh FailureHook) Option {
+	return func(c *HttpClient) {
+		c.failureHook = fh
+	}
+}
+
+// WithCookieJar sets the cookie jar used to store and send cookies.
+// See NewCookieJar for an in-memory implementation.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *HttpClient) {
+		c.jar = jar
+	}
+}
+
+// WithResponseHookSkipOnRetry controls whether the response hook skips
+// intermediate responses which are retried and only runs on the final one.
+func WithResponseHookSkipOnRetry(skip bool) Option {
+	return func(c *HttpClient) {
+		c.finalRespHook = skip
+	}
+}
+
+// WithCheckRedirect sets the redirect policy of the default http client.
+// It has no effect when a custom Doer is used.
+func WithCheckRedirect(fn func(req *http.Request, via []*http.Request) error) Option {
+	return func(c *HttpClient) {
+		c.checkRedirect = fn
+	}
+}
+
+// WithNoRedirect disables following redirects by the default http client,
+// the redirect response is returned to the caller.
+func WithNoRedirect() Option {
+	return WithCheckRedirect(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	})
+}
+
+// WithTransport sets the transport of the default http client.
+// It has no effect when a custom Doer is used.
+func WithTransport(t http.RoundTripper) Option {
+	return func(c *HttpClient) {
+		if t == nil {
+			return
+		}
+		c.transport = t
+		c.ownTransport = nil
+	}
+}
+
+// WithConnectionPool tunes the connection pool of the default http client.
+func WithConnectionPool(maxIdle, maxIdlePerHost int, idleTimeout time.Duration) Option {
+	return func(c *HttpClient) {
+		t := c.defaultTransport()
+		t.MaxIdleConns = maxIdle
+		t.MaxIdleConnsPerHost = maxIdlePerHost
+		t.IdleConnTimeout = idleTimeout
+	}
+}
+
+// WithDisableKeepAlives disables keep-alives on the transport of the
+// default http client, so every connection is closed after its request.
+// Like WithConnectionPool it is applied on top of the transport set so far;
+// a transport set afterwards with WithTransport replaces it. Unlike
+// WithForceClose it also covers requests made by the transport on its own,
+// such as redirects, and applies to the default http client only.
+func WithDisableKeepAlives() Option {
+	return func(c *HttpClient) {
+		c.defaultTransport().DisableKeepAlives = true
+	}
+}
+
+// WithForceClose makes Do set Close on every request, so the connection is
+// closed once the response is read instead of being reused. It is off by
+// default.
+func WithForceClose() Option {
+	return func(c *HttpClient) {
+		c.forceClose = true
+	}
+}
+
+// WithStreamReconnect makes Stream request an ended event stream again,
+// after the wait set by the server or DefaultStreamReconnectWait, with the
+// Last-Event-ID header so the server can resume it.
+func WithStreamReconnect() Option {
+	return func(c *HttpClient) {
+		c.streamReconnect = true
+	}
+}
+
+// WithLastErrorOnly makes Do return the error of the last failed attempt
+// instead of the RetryError aggregating the errors of every attempt.
+func WithLastErrorOnly() Option {
+	return func(c *HttpClient) {
+		c.lastErrorOnly = true
+	}
+}
+
+// WithResponseBodyCapture passes the first max bytes of the body of every
+// response, retried ones included, to sink, e.g. to log them. The prefix
+// is kept as the body is read and passed to sink once max bytes are read,
+// on EOF or on Close: Do never reads ahead, so streamed responses are not
+// held back, and a body which is never read nor closed is never captured.
+func WithResponseBodyCapture(max int64, sink func(body []byte)) Option {
+	return func(c *HttpClient) {
+		if max < 0 {
+			c.setErr(errors.Wrapf(ErrInvalidOption, "body capture size %d", max))
+			return
+		}
+		c.captureMax = max
+		c.captureSink = sink
+	}
+}
+
+// WithResponseHeaderTimeout limits the time to wait for the response
+// headers once the request is written, independently of WithTimeout.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(c *HttpClient) {
+		c.defaultTransport().ResponseHeaderTimeout = d
+	}
+}
+
+// WithBudgetHeader sets the header carrying the remaining time budget in
+// milliseconds on each attempt. The budget is taken from the request
+// context deadline, requests without a deadline are left untouched.
+func WithBudgetHeader(name string) Option {
+	return func(c *HttpClient) {
+		c.budgetHeader = name
+	}
+}
+
+// WithProxy routes the requests of the default http client through the
+// given proxy. New returns an error if the proxy URL is invalid.
+func WithProxy(proxyURL string) Option {
+	return func(c *HttpClient) {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			c.setErr(errors.Wrap(err, "proxy - invalid url"))
+			return
+		}
+		if len(u.Scheme) == 0 || len(u.Host) == 0 {
+			c.setErr(errors.Errorf("proxy - invalid url %q", proxyURL))
+			return
+		}
+		c.defaultTransport().Proxy = http.ProxyURL(u)
+	}
+}
+
+// WithProxyFromEnvironment configures the default http client to use the
+// proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func WithProxyFromEnvironment() Option {
+	return func(c *HttpClient) {
+		c.defaultTransport().Proxy = http.ProxyFromEnvironment
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the default http client.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *HttpClient) {
+		c.defaultTransport().TLSClientConfig = cfg
+		c.ownTLS = false
+	}
+}
+
+// WithRootCAs sets the certificate authorities used by the default http
+// client to verify server certificates.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *HttpClient) {
+		c.tlsConfig().RootCAs = pool
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of server certificates.
+// The client is open to man-in-the-middle attacks, never use it in production.
+func WithInsecureSkipVerify() Option {
+	return func(c *HttpClient) {
+		c.tlsConfig().InsecureSkipVerify = true
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker shared by all requests.
+// Requests rejected by the breaker fail fast with ErrCircuitOpen.
+// See NewCircuitBreaker for a built-in implementation.
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(c *HttpClient) {
+		c.breaker = cb
+	}
+}
+
+// WithPerHostCircuitBreaker keeps an independent circuit breaker for every
+// target host, created by the factory on the first request to the host.
+func WithPerHostCircuitBreaker(factory func() CircuitBreaker) Option {
+	return func(c *HttpClient) {
+		if factory == nil {
+			return
+		}
+		c.hostBreakers = newHostBreakers(factory)
+	}
+}
+
+// WithRetryForIncompleteResponse buffers the response body and retries
+// the request when the body is shorter than its Content-Length. The retry
+// follows the policy of status retries: CheckRetry is called with the
+// ErrIncompleteResponse error when set, otherwise only the retryable
+// methods are retried.
+func WithRetryForIncompleteResponse() Option {
+	return func(c *HttpClient) {
+		c.retryIncomplete = true
+	}
+}
+
+// WithRetryOnEmptyBody buffers the body of 200 OK responses and retries
+// the request when it is empty. The retry follows the policy of status
+// retries: CheckRetry is called with ErrEmptyResponse when set, otherwise
+// only the retryable methods are retried. The empty response is returned
+// once the retries are exhausted.
+func WithRetryOnEmptyBody() Option {
+	return func(c *HttpClient) {
+		c.retryEmptyBody = true
+	}
+}
+
+// WithRateLimiter sets the limiter waited on before each attempt, retries
+// included. See NewRateLimiter for a built-in token bucket.
+func WithRateLimiter(l RateLimiter) Option {
+	return func(c *HttpClient) {
+		c.limiter = l
+	}
+}
+
+// WithMaxRequestBodySize rejects requests with a body larger than n bytes
+// before they are sent. With WithBodyBuffering(false) a body of unknown
+// length is streamed and fails with ErrRequestBodyTooLarge once n bytes
+// are exceeded.
+func WithMaxRequestBodySize(n int64) Option {
+	return func(c *HttpClient) {
+		c.maxRequestBody = n
+	}
+}
+
+// WithMetrics sets the collector recording every attempt and retry.
+func WithMetrics(mc MetricsCollector) Option {
+	return func(c *HttpClient) {
+		c.metrics = mc
+	}
+}
+
+// WithResponseHeaderNormalization collapses duplicated values of the named
+// response headers according to the strategy.
+func WithResponseHeaderNormalization(strategy HeaderStrategy, names ...string) Option {
+	return func(c *HttpClient) {
+		if c.headerStrategies == nil {
+			c.headerStrategies = make(map[string]HeaderStrategy)
+		}
+		for _, name := range names {
+			c.headerStrategies[http.CanonicalHeaderKey(name)] = strategy
+		}
+	}
+}
+
+// WithTracer sets the tracer starting a span for every request and a child
+// span for every attempt. The trace context is injected into the headers.
+func WithTracer(t Tracer) Option {
+	return func(c *HttpClient) {
+		c.tracer = t
+	}
+}
+
+// WithLogger sets the logger of requests, attempts and retries.
+// Sensitive headers such as Authorization are redacted from the logs, and
+// URLs are logged without their userinfo and query.
+func WithLogger(l Logger) Option {
+	return func(c *HttpClient) {
+		c.logger = l
+	}
+}
+
+// WithLogHeaders allows the named sensitive headers to be logged unredacted.
+func WithLogHeaders(names ...string) Option {
+	return func(c *HttpClient) {
+		if c.logAllowedHeaders == nil {
+			c.logAllowedHeaders = make(map[string]bool)
+		}
+		for _, name := range names {
+			c.logAllowedHeaders[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// WithSequenceHeader sets the header carrying a per client sequence number,
+// incremented on every Do call. Retries of a call share its number.
+func WithSequenceHeader(name string) Option {
+	return func(c *HttpClient) {
+		c.sequenceHeader = name
+		if c.sequence == nil {
+			c.sequence = new(uint64)
+		}
+	}
+}
+
+// WithRequestIDHeader sets the header carrying the request ID extracted
+// from the request context, so it is propagated to the called services. A
+// nil extractor reads the ID set with ContextWithRequestID. The header is
+// left alone when empty IDs are extracted or when the request already has
+// it.
+func WithRequestIDHeader(header string, extractor func(ctx context.Context) string) Option {
+	return func(c *HttpClient) {
+		if extractor == nil {
+			extractor = RequestIDFromContext
+		}
+		c.requestIDHeader = header
+		c.requestID = extractor
+	}
+}
+
+// WithRequestSigner sets the signer called on every attempt, after the
+// request hooks and right before the request is sent. A signing error
+// stops the retries and is returned by Do.
+func WithRequestSigner(s Signer) Option {
+	return func(c *HttpClient) {
+		c.signer = s
+	}
+}
+
+// WithTokenSource sets the source of the bearer token set on every
+// attempt, overriding any Authorization header. A request answered with
+// 401 Unauthorized is sent once more with a new token within the same
+// attempt, see TokenInvalidator. A token error stops the retries.
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *HttpClient) {
+		c.tokenSource = ts
+	}
+}
+
+// WithMiddleware wraps the Doer with the middlewares. The first middleware
+// is the outermost one and sees the request first. Middlewares run on
+// every attempt, retries included.
+func WithMiddleware(m ...Middleware) Option {
+	return func(c *HttpClient) {
+		c.middlewares = append(c.middlewares, m...)
+	}
+}
+
+// WithMethodMiddleware adds a middleware which only runs for requests with
+// the given method, e.g. to sign write requests. It keeps its position
+// among the middlewares added with WithMiddleware.
+func WithMethodMiddleware(method string, m Middleware) Option {
+	return func(c *HttpClient) {
+		c.middlewares = append(c.middlewares, methodMiddleware(method, m))
+	}
+}
+
+// WithAutoDecompress transparently decompresses gzip encoded response
+// bodies which were not decoded by the transport.
+func WithAutoDecompress() Option {
+	return func(c *HttpClient) {
+		c.autoDecompress = true
+	}
+}
+
+// WithCharsetDecoding transcodes response bodies declared in another
+// charset by the Content-Type header, e.g. ISO-8859-1, to UTF-8.
+func WithCharsetDecoding() Option {
+	return func(c *HttpClient) {
+		c.decodeCharset = true
+	}
+}
+
+// WithRequestCompression gzip compresses non-empty request bodies and sets
+// the Content-Encoding header.
+func WithRequestCompression() Option {
+	return func(c *HttpClient) {
+		c.compressRequest = true
+	}
+}
+
+// WithResponseHookAsync runs the response hook in its own goroutine so it
+// never blocks the request. The hook receives copies of the request and
+// response, the live body is not available to it.
+func WithResponseHookAsync() Option {
+	return func(c *HttpClient) {
+		c.asyncRespHook = true
+	}
+}
+
+// WithMaxResponseBodySize limits response bodies to n bytes, reading past
+// the limit fails with ErrBodyTooLarge. Retried bodies drained by the client
+// are capped by the same limit.
+func WithMaxResponseBodySize(n int64) Option {
+	return func(c *HttpClient) {
+		c.maxResponseBody = n
+	}
+}
+
+// WithRetryWaits sets an explicit schedule of waits between attempts used
+// instead of the back off policy: the retry after attempt i waits waits[i].
+// Retries stop once the schedule is exhausted even if the retry count is higher.
+func WithRetryWaits(waits []time.Duration) Option {
+	return func(c *HttpClient) {
+		c.retryWaits = append([]time.Duration{}, waits...)
+	}
+}
+
+// WithRetryableMethods sets the methods the default retry policy retries on
+// a 5xx response. Connection errors and unusable response bodies are only
+// retried for these methods, even when CheckRetry is set, as the server
+// may have processed the request already. By default only idempotent
+// methods are retried, so a POST or PATCH is never sent twice unless
+// listed here.
+func WithRetryableMethods(methods ...string) Option {
+	return func(c *HttpClient) {
+		c.retryableMethods = methodSet(methods)
+	}
+}
+
+// WithRetryStatusCodes replaces the 5xx condition of the default retry
+// policy with the given status codes, e.g. 429 and 503. Connection errors
+// are still retried. It has no effect when WithCheckRetry is set.
+func WithRetryStatusCodes(codes ...int) Option {
+	return func(c *HttpClient) {
+		c.retryStatusCodes = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			c.retryStatusCodes[code] = true
+		}
+	}
+}
+
+// WithPathEscaping controls how request paths are joined with the base URL.
+// By default paths are used as given, so already escaped segments such as
+// %2F reach the server intact. When enabled every path segment is escaped,
+// which suits paths built from raw, unescaped values.
+func WithPathEscaping(escape bool) Option {
+	return func(c *HttpClient) {
+		c.escapePath = escape
+	}
+}
+
+// WithRetryBudget bounds the wall-clock time spent retrying. Once the time
+// elapsed since the first attempt plus the next wait would exceed the
+// budget, the last response or error is returned. It composes with
+// WithRetryCount, whichever limit is hit first wins.
+func WithRetryBudget(d time.Duration) Option {
+	return func(c *HttpClient) {
+		c.retryBudget = d
+	}
+}
+
+// WithMaxRetryWait caps the wait between attempts, whatever the back off
+// policy, the retry wait schedule or the back off hook computed.
+func WithMaxRetryWait(d time.Duration) Option {
+	return func(c *HttpClient) {
+		c.maxRetryWait = d
+	}
+}
+
+// WithBackoffCeilingRandomization makes every Do call cap its waits at a
+// random limit between (1-band) and 1 times the WithMaxRetryWait limit, so
+// clients don't all retry at the same maximum pace. band is within [0, 1].
+func WithBackoffCeilingRandomization(band float64) Option {
+	return func(c *HttpClient) {
+		c.ceilingBand = band
+	}
+}
+
+// WithRandSource sets the source of randomness used by the client. The
+// source isn't safe for concurrent use, clients derived with With share it
+// behind a single lock.
+func WithRandSource(src rand.Source) Option {
+	r := newLockedRand(src)
+	return func(c *HttpClient) {
+		c.rand = r
+	}
+}
+
+// WithRetryProbe sends a GET request to path on the request host while
+// waiting for a retry. When the probe succeeds within timeout the retry
+// proceeds without waiting for the rest of the back off.
+func WithRetryProbe(path string, timeout time.Duration) Option {
+	return func(c *HttpClient) {
+		c.probePath = path
+		c.probeTimeout = timeout
+	}
+}
+
+// WithDoerForScheme dispatches requests with the given URL scheme to the
+// Doer, other requests use the default one.
+func WithDoerForScheme(scheme string, d Doer) Option {
+	return func(c *HttpClient) {
+		if d == nil {
+			return
+		}
+		if c.schemeDoers == nil {
+			c.schemeDoers = make(map[string]Doer)
+		}
+		c.schemeDoers[strings.ToLower(scheme)] = d
+	}
+}
+
+// WithBodyBuffering controls whether request bodies without GetBody are
+// buffered in memory to be replayed on retries. Buffering is enabled by
+// default, without it such requests are not retried.
+func WithBodyBuffering(enabled bool) Option {
+	return func(c *HttpClient) {
+		c.noBodyBuffering = !enabled
+	}
+}
+
+// WithRetryOnlyIfBodyReplayable makes Do return ErrBodyNotReplayable when
+// a retry is needed but the request body can't be replayed, instead of
+// silently returning the last response.
+func WithRetryOnlyIfBodyReplayable() Option {
+	return func(c *HttpClient) {
+		c.requireReplayable = true
+	}
+}
+
+// WithAfterResponseBodyRead sets a hook called when the caller finishes
+// reading the returned response body or closes it.
+func WithAfterResponseBodyRead(hook BodyReadHook) Option {
+	return func(c *HttpClient) {
+		c.bodyReadHook = hook
+	}
+}
+
+// WithUserAgent sets the User-Agent header on requests which don't have one.
+func WithUserAgent(ua string) Option {
+	return func(c *HttpClient) {
+		c.userAgent = ua
+	}
+}
+
+// WithAccept sets the Accept header on requests which don't have one. The
+// media types are listed in order, each may carry its quality weight:
+//
+//	WithAccept("application/json", "application/xml;q=0.9", "*/*;q=0.1")
+func WithAccept(mimeTypes ...string) Option {
+	return func(c *HttpClient) {
+		types := make([]string, 0, len(mimeTypes))
+		for _, t := range mimeTypes {
+			if t = strings.TrimSpace(t); len(t) > 0 {
+				types = append(types, t)
+			}
+		}
+		c.accept = strings.Join(types, ", ")
+	}
+}
+
+// WithAttemptContext derives the context of each attempt from the request
+// context, e.g. to attach the attempt number for hooks and middlewares.
+func WithAttemptContext(fn func(ctx context.Context, attempt int) context.Context) Option {
+	return func(c *HttpClient) {
+		c.attemptContext = fn
+	}
+}
+
+// WithPerAttemptTimeout bounds every attempt with its own timeout, while
+// the request context deadline keeps bounding the whole call including
+// retries and the waits between them.
+func WithPerAttemptTimeout(d time.Duration) Option {
+	return func(c *HttpClient) {
+		c.attemptTimeout = d
+	}
+}
+
+// WithResponseValidators adds validators run in order on the response
+// returned by Do. The first error is returned along with the response.
+// The body is buffered so every validator and the caller can read it.
+func WithResponseValidators(validators ...func(*http.Response) error) Option {
+	return func(c *HttpClient) {
+		c.validators = append(c.validators, validators...)
+	}
+}
+
+// WithHedging sends up to maxExtra more copies of idempotent requests,
+// spaced by delay, while no successful response came back. The first
+// successful response is returned and the other copies are canceled.
+// Hedging applies within each attempt, so a request makes at most
+// (retry count + 1) * (maxExtra + 1) calls to the Doer.
+func WithHedging(delay time.Duration, maxExtra int) Option {
+	return func(c *HttpClient) {
+		c.hedgeDelay = delay
+		c.hedgeExtra = maxExtra
+	}
+}
+
+// WithResponseCache serves GET requests from the cache. Successful
+// responses are stored for ttl unless they carry Cache-Control: no-store.
+func WithResponseCache(cache Cache, ttl time.Duration) Option {
+	return func(c *HttpClient) {
+		c.cache = cache
+		c.cacheTTL = ttl
+	}
+}
+
+// WithResponseCacheRevalidation keeps cached responses with an ETag or
+// Last-Modified header for d after they expire. A stale response is then
+// revalidated with If-None-Match/If-Modified-Since and served again when
+// the server answers 304 Not Modified.
+func WithResponseCacheRevalidation(d time.Duration) Option {
+	return func(c *HttpClient) {
+		c.cacheRevalidate = d
+	}
+}
+
+// WithGetResultCache serves repeated GET requests for the same URL from
+// memory for ttl after a successful response, without calling the Doer.
+// Every caller gets its own copy of the body. It is a shorthand for
+// WithResponseCache with a NewMemoryCache, created for every client so
+// clients derived with With don't share it.
+func WithGetResultCache(ttl time.Duration) Option {
+	return func(c *HttpClient) {
+		WithResponseCache(NewMemoryCache(), ttl)(c)
+	}
+}
+
+// WithGracefulShutdown lets an attempt in flight when the request context
+// is canceled run for up to grace before it is aborted. A cancellation
+// during the wait between attempts stops the retries and returns the
+// outcome of the last attempt instead of the context error.
+func WithGracefulShutdown(grace time.Duration) Option {
+	return func(c *HttpClient) {
+		c.shutdownGrace = grace
+	}
+}
+
+// WithLatencyTracking keeps the latencies of the last samples attempts to
+// report them with LatencySummary.
+func WithLatencyTracking(samples int) Option {
+	return func(c *HttpClient) {
+		if samples < 0 {
+			samples = 0
+		}
+		c.latency = newLatencyReservoir(samples)
+	}
+}
+
+// WithOnSuccess sets a function called once per Do call when it returns a
+// 2xx response without error, e.g. to release an idempotency key.
+func WithOnSuccess(fn func(*http.Request, *http.Response)) Option {
+	return func(c *HttpClient) {
+		c.onSuccess = fn
+	}
+}
+
+// WithRecoverHooks recovers from panics in the request, response, error,
+// failure, back off, success and body read hooks, the CheckRetry and
+// BackOff policies and the ErrorHandler, so a buggy hook doesn't crash the
+// caller. Recovered panics are passed to the PanicHandler or logged with
+// the Logger.
+func WithRecoverHooks() Option {
+	return func(c *HttpClient) {
+		c.recoverHooks = true
+	}
+}
+
+// WithPanicHandler sets the handler receiving panics recovered with
+// WithRecoverHooks.
+func WithPanicHandler(h PanicHandler) Option {
+	return func(c *HttpClient) {
+		c.panicHandler = h
+	}
+}
+
+// WithExpectStatus makes Do return an UnexpectedStatusError when the
+// status code of the final response, after retries, is not one of codes.
+// The response is returned along with the error.
+func WithExpectStatus(codes ...int) Option {
+	return func(c *HttpClient) {
+		if c.expectStatus == nil {
+			c.expectStatus = make(map[int]bool, len(codes))
+		}
+		for _, code := range codes {
+			c.expectStatus[code] = true
+		}
+	}
+}
+
+// WithObservableDoer moves the metrics and latency observation from the
+// attempts of Do onto the Doer itself, so every call made to it is
+// observed, including hedged copies and probes. The Doer is wrapped
+// before the middlewares, which are not part of the observed duration.
+func WithObservableDoer() Option {
+	return func(c *HttpClient) {
+		c.observableDoer = true
+	}
+}
+
+// WithTimeoutFromHeader bounds the calls to Do whose request context has
+// no deadline with the timeout found in the named request header, as a
+// duration such as "1.5s" or a number of milliseconds. It lets a gateway
+// propagate the budget of an inbound request. Missing or malformed values
+// are ignored.
+func WithTimeoutFromHeader(name string) Option {
+	return func(c *HttpClient) {
+		c.timeoutHeader = name
+	}
+}
+
+// WithOnStatusChange sets a function called when the status code of an
+// attempt differs from the one of the previous attempt which got a
+// response, e.g. twice for 503, 500 then 200. Attempts failing without a
+// response are skipped. It helps to detect flapping upstreams.
+func WithOnStatusChange(fn func(from, to int, attempt int)) Option {
+	return func(c *HttpClient) {
+		c.onStatusChange = fn
+	}
+}
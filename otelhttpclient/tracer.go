@@ -0,0 +1,95 @@
+// Package otelhttpclient traces httpclient requests with OpenTelemetry.
+// It lives in its own module so the core client doesn't depend on otel.
+package otelhttpclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/mediabuyerbot/httpclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer obtained from the provider.
+const instrumentationName = "github.com/mediabuyerbot/httpclient"
+
+// WithTracerProvider traces requests with a tracer of the provider: a span
+// for every Do call and a child span for every attempt. The trace context
+// of the attempt is injected into the request headers with the global
+// propagator. A nil provider stands for the global one.
+func WithTracerProvider(tp trace.TracerProvider) httpclient.Option {
+	return httpclient.WithTracer(NewTracer(tp, nil))
+}
+
+// NewTracer adapts an OpenTelemetry tracer provider and propagator to
+// httpclient.Tracer, see httpclient.WithTracer. Nil arguments stand for
+// the global provider and propagator.
+func NewTracer(tp trace.TracerProvider, propagator propagation.TextMapPropagator) httpclient.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &tracer{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: propagator,
+	}
+}
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func (t *tracer) Start(ctx context.Context, spanName string) (context.Context, httpclient.Span) {
+	ctx, s := t.tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, span{span: s}
+}
+
+func (t *tracer) Inject(ctx context.Context, header http.Header) {
+	propagator := t.propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// span adapts an OpenTelemetry span to httpclient.Span.
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(attributeOf(key, value))
+}
+
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+// attributeOf converts the value to an attribute, falling back to its
+// string form for types otel has no attribute for.
+func attributeOf(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,137 @@
+package otelhttpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mediabuyerbot/httpclient"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func noBackOff(attemptNum int, resp *http.Response) time.Duration {
+	return 0
+}
+
+// flakyServer answers 503 to the first request and 200 afterwards. It
+// records the trace context received with every request.
+func flakyServer() (*httptest.Server, func() []trace.SpanContext) {
+	var (
+		mu       sync.Mutex
+		received []trace.SpanContext
+	)
+	propagator := propagation.TraceContext{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(context.Background(), propagation.HeaderCarrier(r.Header))
+		mu.Lock()
+		received = append(received, trace.SpanContextFromContext(ctx))
+		first := len(received) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, func() []trace.SpanContext {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]trace.SpanContext(nil), received...)
+	}
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestWithTracerProvider(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(prev)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	server, received := flakyServer()
+	defer server.Close()
+
+	cli, err := httpclient.New(
+		WithTracerProvider(tp),
+		httpclient.WithRetryCount(1),
+		httpclient.WithBackOff(noBackOff),
+	)
+	assert.Nil(t, err)
+	resp, err := cli.Get(context.Background(), server.URL+"/path", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body.Close())
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	first, second, root := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "HTTP GET", root.Name())
+	assert.False(t, root.Parent().IsValid())
+	assert.Equal(t, trace.SpanKindClient, root.SpanKind())
+	assert.Equal(t, "GET", attributeValue(root, "http.method").AsString())
+	assert.Equal(t, server.URL+"/path", attributeValue(root, "http.url").AsString())
+	assert.Equal(t, int64(http.StatusOK), attributeValue(root, "http.status_code").AsInt64())
+
+	// a child span per attempt, its trace context is sent to the server
+	headers := received()
+	assert.Len(t, headers, 2)
+	for i, attempt := range []sdktrace.ReadOnlySpan{first, second} {
+		assert.Equal(t, "HTTP GET attempt", attempt.Name())
+		assert.Equal(t, root.SpanContext().TraceID(), attempt.SpanContext().TraceID())
+		assert.Equal(t, root.SpanContext().SpanID(), attempt.Parent().SpanID())
+		assert.Equal(t, int64(i), attributeValue(attempt, "http.retry_count").AsInt64())
+		assert.Equal(t, attempt.SpanContext().TraceID(), headers[i].TraceID())
+		assert.Equal(t, attempt.SpanContext().SpanID(), headers[i].SpanID())
+	}
+	assert.Equal(t, int64(http.StatusServiceUnavailable), attributeValue(first, "http.status_code").AsInt64())
+	assert.Equal(t, int64(http.StatusOK), attributeValue(second, "http.status_code").AsInt64())
+}
+
+func TestNewTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() { _ = tp.Shutdown(context.Background()) }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.Header.Get("Traceparent"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	cli, err := httpclient.New(httpclient.WithTracer(NewTracer(tp, propagation.TraceContext{})))
+	assert.Nil(t, err)
+	resp, err := cli.Get(context.Background(), server.URL, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+
+	// the request fails once the server is gone
+	server.Close()
+	_, err = cli.Get(context.Background(), server.URL, nil)
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 4)
+	for _, span := range spans[2:] {
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.NotEmpty(t, span.Events())
+	}
+}
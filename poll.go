@@ -0,0 +1,46 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// DoUntil performs the request repeatedly, waiting interval between calls,
+// until done reports true or returns an error, or the context expires.
+// The response accepted by done is returned to the caller.
+func (c *HttpClient) DoUntil(ctx context.Context, req *http.Request, done func(*http.Response) (bool, error), interval time.Duration) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		data, err := c.readRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	for {
+		r := req.Clone(ctx)
+		if body != nil {
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := c.Do(r)
+		if err != nil {
+			return resp, err
+		}
+		ok, err := done(resp)
+		if ok || err != nil {
+			return resp, err
+		}
+		c.discardResponse(resp)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_DoUntil(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "job=1", string(body))
+		if calls < 3 {
+			_, _ = w.Write([]byte("pending"))
+			return
+		}
+		_, _ = w.Write([]byte("complete"))
+	}))
+	defer server.Close()
+
+	client, err := New()
+	assert.Nil(t, err)
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("job=1"))
+	assert.Nil(t, err)
+	resp, err := client.DoUntil(context.TODO(), req, func(resp *http.Response) (bool, error) {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		return string(b) == "complete", nil
+	}, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, calls)
+
+	// context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, err = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("job=1"))
+	assert.Nil(t, err)
+	resp, err = client.DoUntil(ctx, req, func(resp *http.Response) (bool, error) {
+		return false, nil
+	}, 5*time.Millisecond)
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
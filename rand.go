@@ -0,0 +1,22 @@
+package httpclient
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// lockedRand makes a rand.Rand safe for concurrent Do calls.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(src rand.Source) *lockedRand {
+	return &lockedRand{r: rand.New(src)}
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Float64()
+}
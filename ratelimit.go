@@ -0,0 +1,84 @@
+package httpclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter blocks until a request may be dispatched or the context is
+// done. The *rate.Limiter from golang.org/x/time/rate satisfies it.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// tokenBucket is a minimal token bucket rate limiter.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  clock
+}
+
+// NewRateLimiter returns a token bucket limiter allowing perSecond requests
+// per second with bursts of up to burst requests. perSecond must be
+// positive, New rejects the limiter with ErrInvalidOption otherwise.
+func NewRateLimiter(perSecond float64, burst int) RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		clock:  realClock{},
+	}
+}
+
+// validRate reports whether a built-in limiter has a positive rate.
+// Other limiters are trusted.
+func validRate(l RateLimiter) bool {
+	b, ok := l.(*tokenBucket)
+	return !ok || b.rate > 0
+}
+
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	delay := b.reserve()
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-b.clock.After(delay):
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token to the bucket.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
@@ -0,0 +1,70 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_RateLimiter(t *testing.T) {
+	const perSecond = 20
+	start := time.Unix(0, 0)
+	clk := &fakeClock{now: start}
+	limiter := NewRateLimiter(perSecond, 1)
+	limiter.(*tokenBucket).clock = clk
+	limiter.(*tokenBucket).last = start
+	client, doer, done := newClient(t, WithRateLimiter(limiter))
+	defer done()
+
+	doer.EXPECT().Do(gomock.Any()).Times(perSecond+1).Return(&http.Response{StatusCode: 200}, nil)
+	for i := 0; i <= perSecond; i++ {
+		_, err := client.Get(context.TODO(), "http://test.com", nil)
+		assert.Nil(t, err)
+	}
+	// the burst is spent at once, every other request waits for a token
+	assert.Len(t, clk.waits, perSecond)
+	assert.InDelta(t, float64(time.Second), float64(clk.now.Sub(start)), float64(time.Millisecond))
+}
+
+func TestHttpClient_RateLimiterContextCanceled(t *testing.T) {
+	client, _, done := newClient(t, WithRateLimiter(NewRateLimiter(0.1, 1)))
+	defer done()
+
+	limiter := client.(*HttpClient).limiter
+	assert.Nil(t, limiter.Wait(context.TODO()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := client.Get(ctx, "http://test.com", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, resp)
+}
+
+func TestHttpClient_RateLimiterHalfOpenBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.(*consecutiveBreaker).now = func() time.Time { return now }
+	client, _, done := newClient(t,
+		WithCircuitBreaker(breaker),
+		WithRateLimiter(NewRateLimiter(0.1, 1)),
+	)
+	defer done()
+
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	now = now.Add(time.Minute)
+
+	// the limiter is waited on before the breaker lets the probe through
+	limiter := client.(*HttpClient).limiter
+	assert.Nil(t, limiter.Wait(context.TODO()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := client.Get(ctx, "http://test.com", nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, resp)
+	assert.True(t, breaker.Allow())
+}
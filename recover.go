@@ -0,0 +1,66 @@
+package httpclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// PanicHandler receives a panic recovered from a user function, named by
+// hook, when WithRecoverHooks is set.
+type PanicHandler func(hook string, recovered interface{})
+
+// guard runs fn and, when WithRecoverHooks is set, recovers from a panic
+// in it. It reports whether fn returned normally.
+func (c *HttpClient) guard(hook string, fn func()) (ok bool) {
+	if !c.recoverHooks {
+		fn()
+		return true
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+			c.handlePanic(hook, r)
+		}
+	}()
+	fn()
+	return true
+}
+
+func (c *HttpClient) handlePanic(hook string, recovered interface{}) {
+	switch {
+	case c.panicHandler != nil:
+		c.panicHandler(hook, recovered)
+	case c.logger != nil:
+		c.logger.Errorf("%s panic: %v", hook, recovered)
+	}
+}
+
+// runCheckRetry calls the CheckRetry policy. A recovered panic stops the
+// retries.
+func (c *HttpClient) runCheckRetry(req *http.Request, resp *http.Response, err error) (ok bool, checkErr error) {
+	if !c.guard("check retry", func() { ok, checkErr = c.checkRetry(req, resp, err) }) {
+		return false, nil
+	}
+	return ok, checkErr
+}
+
+// runBackOff calls the BackOff policy. A recovered panic falls back to the
+// default policy.
+func (c *HttpClient) runBackOff(attemptNum int, resp *http.Response) (wait time.Duration) {
+	if !c.guard("back off", func() { wait = c.backOff(attemptNum, resp) }) {
+		return defaultBackOffPolicy(attemptNum, resp)
+	}
+	return wait
+}
+
+// runErrorHandler calls the ErrorHandler. A recovered panic returns the
+// response and error as they were.
+func (c *HttpClient) runErrorHandler(req *http.Request, resp *http.Response, err error, numTries int) (*http.Response, error) {
+	handledResp, handledErr := resp, err
+	if !c.guard("error handler", func() {
+		handledResp, handledErr = c.errorHandler(req.Context(), req, resp, err, numTries)
+	}) {
+		return resp, err
+	}
+	return handledResp, handledErr
+}
@@ -0,0 +1,108 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_RecoverHooks(t *testing.T) {
+	var panics []string
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRecoverHooks(),
+		WithPanicHandler(func(hook string, recovered interface{}) {
+			panics = append(panics, hook+": "+recovered.(string))
+		}),
+		WithRetryCount(2),
+		WithRequestHook(func(req *http.Request, retry int) { panic("request") }),
+		WithResponseHook(func(req *http.Request, resp *http.Response) { panic("response") }),
+		WithErrorHook(func(req *http.Request, err error, retry int) { panic("error") }),
+		WithFailureHook(func(req *http.Request, resp *http.Response, err error, retry int) { panic("failure") }),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { panic("backoff") }),
+		WithBackOffHook(func(attemptNum int, resp *http.Response, wait *time.Duration) { panic("backoff hook") }),
+		WithOnSuccess(func(req *http.Request, resp *http.Response) { panic("success") }),
+		WithAfterResponseBodyRead(func(req *http.Request, n int64, d time.Duration) { panic("body read") }),
+		WithErrorHandler(func(resp *http.Response, err error, numTries int) (*http.Response, error) {
+			panic("handler")
+		}),
+	)
+	defer done()
+
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil),
+	)
+	resp, _ := client.Get(context.Background(), "https://google.com", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, resp.Body.Close())
+	// the back off hook panics leave the default back off in place
+	assert.Len(t, clk.waits, 2)
+	assert.Equal(t, []string{
+		"request hook: request",
+		"error hook: error",
+		"failure hook: failure",
+		"back off: backoff",
+		"back off hook: backoff hook",
+		"request hook: request",
+		"response hook: response",
+		"failure hook: failure",
+		"back off: backoff",
+		"back off hook: backoff hook",
+		"request hook: request",
+		"response hook: response",
+		"error handler: handler",
+		"body read hook: body read",
+	}, panics)
+
+	panics = nil
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200, Body: http.NoBody}, nil)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, []string{
+		"request hook: request",
+		"response hook: response",
+		"success hook: success",
+		"error handler: handler",
+		"body read hook: body read",
+	}, panics)
+}
+
+func TestHttpClient_RecoverCheckRetry(t *testing.T) {
+	logger := &captureLogger{}
+	client, doer, done := newClient(t,
+		WithRecoverHooks(),
+		WithLogger(logger),
+		WithRetryCount(3),
+		WithCheckRetry(func(req *http.Request, resp *http.Response, err error) (bool, error) {
+			panic("check")
+		}),
+	)
+	defer done()
+
+	// the panic stops the retries
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 503}, nil)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Contains(t, logger.lines, "ERROR check retry panic: check")
+}
+
+func TestHttpClient_HooksPanicWithoutRecover(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithResponseHook(func(req *http.Request, resp *http.Response) { panic("response") }),
+	)
+	defer done()
+
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil)
+	assert.PanicsWithValue(t, "response", func() {
+		_, _ = client.Get(context.Background(), "https://google.com", nil)
+	})
+}
@@ -0,0 +1,18 @@
+package httpclient
+
+import "context"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID read
+// by the default extractor of WithRequestIDHeader.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set with
+// ContextWithRequestID, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
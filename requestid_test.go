@@ -0,0 +1,49 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_RequestIDHeader(t *testing.T) {
+	client, doer, done := newClient(t, WithRequestIDHeader("X-Request-ID", nil))
+	defer done()
+	var ids []string
+	record := func(req *http.Request) {
+		ids = append(ids, req.Header.Get("X-Request-ID"))
+	}
+	doer.EXPECT().Do(gomock.Any()).Times(4).Return(&http.Response{StatusCode: 200}, nil).Do(record)
+
+	ctx := ContextWithRequestID(context.Background(), "req-1")
+	_, err := client.Get(ctx, "http://test.com", nil)
+	assert.Nil(t, err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "http://test.com", nil)
+	assert.Nil(t, err)
+	_, err = client.Do(req)
+	assert.Nil(t, err)
+	_, err = client.Get(context.Background(), "http://test.com", nil)
+	assert.Nil(t, err)
+	_, err = client.Get(ctx, "http://test.com", http.Header{"X-Request-ID": {"explicit"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"req-1", "req-1", "", "explicit"}, ids)
+}
+
+func TestHttpClient_RequestIDHeaderExtractor(t *testing.T) {
+	type traceKey struct{}
+	client, doer, done := newClient(t, WithRequestIDHeader("X-Trace", func(ctx context.Context) string {
+		id, _ := ctx.Value(traceKey{}).(string)
+		return id
+	}))
+	defer done()
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "trace-7", req.Header.Get("X-Trace"))
+		return &http.Response{StatusCode: 200}, nil
+	})
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-7")
+	_, err := client.Post(ctx, "http://test.com", nil, nil)
+	assert.Nil(t, err)
+}
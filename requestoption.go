@@ -0,0 +1,56 @@
+package httpclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestOption overrides a setting of the client for a single call of
+// DoWithOptions.
+type RequestOption func(*HttpClient)
+
+// WithRequestRetryCount overrides the retry count of the client.
+func WithRequestRetryCount(count int) RequestOption {
+	return func(c *HttpClient) {
+		c.retryCount = count
+	}
+}
+
+// WithRequestAttemptTimeout overrides the per attempt timeout of the
+// client, see WithPerAttemptTimeout.
+func WithRequestAttemptTimeout(d time.Duration) RequestOption {
+	return func(c *HttpClient) {
+		c.attemptTimeout = d
+	}
+}
+
+// WithRequestHeaders adds headers layered over the default headers of the
+// client. Headers already set on the request win on conflict.
+func WithRequestHeaders(h http.Header) RequestOption {
+	return func(c *HttpClient) {
+		headers := make(http.Header, len(c.defaultHeaders)+len(h))
+		for key, values := range c.defaultHeaders {
+			headers[key] = values
+		}
+		for key, values := range h {
+			headers[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+		}
+		c.defaultHeaders = headers
+	}
+}
+
+// DoWithOptions is like Do with the options applied to this call only.
+// The client itself is left unchanged.
+func (c *HttpClient) DoWithOptions(req *http.Request, opts ...RequestOption) (*http.Response, error) {
+	if len(opts) == 0 {
+		return c.Do(req)
+	}
+	call := *c
+	for _, opt := range opts {
+		opt(&call)
+	}
+	if err := call.validate(); err != nil {
+		return nil, err
+	}
+	return call.Do(req)
+}
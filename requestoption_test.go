@@ -0,0 +1,72 @@
+package httpclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_DoWithOptions(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithDefaultHeaders(http.Header{"X-Env": {"prod"}, "X-Priority": {"high"}}),
+	)
+	defer done()
+
+	var headers []http.Header
+	record := func(req *http.Request) {
+		headers = append(headers, req.Header.Clone())
+	}
+
+	// retried up to the per call count
+	doer.EXPECT().Do(gomock.Any()).Times(4).Return(&http.Response{StatusCode: 503}, nil).Do(record)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	req.Header.Set("X-Caller", "explicit")
+	resp, err := client.DoWithOptions(req,
+		WithRequestRetryCount(3),
+		WithRequestHeaders(http.Header{"x-priority": {"low"}, "X-Caller": {"option"}}),
+	)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, "prod", headers[0].Get("X-Env"))
+	assert.Equal(t, "low", headers[0].Get("X-Priority"))
+	assert.Equal(t, "explicit", headers[0].Get("X-Caller"))
+
+	// the next call uses the client defaults
+	headers = nil
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(&http.Response{StatusCode: 503}, nil).Do(record)
+	req, err = http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	_, err = client.Do(req)
+	assert.True(t, errors.Is(err, ErrRetriesExhausted))
+	assert.Equal(t, "high", headers[0].Get("X-Priority"))
+
+	// invalid overrides are rejected
+	_, err = client.DoWithOptions(req, WithRequestAttemptTimeout(-time.Second))
+	assert.True(t, errors.Is(err, ErrInvalidOption))
+}
+
+func TestHttpClient_DoWithOptionsAttemptTimeout(t *testing.T) {
+	client, doer, done := newClient(t)
+	defer done()
+
+	var deadlines []bool
+	doer.EXPECT().Do(gomock.Any()).Times(2).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		_, ok := req.Context().Deadline()
+		deadlines = append(deadlines, ok)
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	_, err = client.DoWithOptions(req, WithRequestAttemptTimeout(time.Minute))
+	assert.Nil(t, err)
+	_, err = client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, []bool{true, false}, deadlines)
+}
@@ -0,0 +1,291 @@
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrIncompleteResponse is returned when fewer bytes than announced by the
+// Content-Length header could be read from the response body.
+var ErrIncompleteResponse = errors.New("incomplete response body")
+
+// ErrEmptyResponse is passed to CheckRetry when WithRetryOnEmptyBody finds
+// a 200 OK response without a body.
+var ErrEmptyResponse = errors.New("empty response body")
+
+// ErrBodyTooLarge is returned when reading a response body beyond the
+// limit set by WithMaxResponseBodySize.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// limitedBody fails with tooLarge once more than the limit is read.
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+	tooLarge  error
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		var probe [1]byte
+		n, err := b.body.Read(probe[:])
+		if n > 0 {
+			return 0, b.tooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// limitResponseBody caps the number of bytes readable from the body.
+func limitResponseBody(resp *http.Response, limit int64) {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	resp.Body = &limitedBody{body: resp.Body, remaining: limit, tooLarge: ErrBodyTooLarge}
+}
+
+// observedBody reports the bytes read from the body to the hook on EOF
+// or Close, whichever comes first.
+type observedBody struct {
+	body    io.ReadCloser
+	req     *http.Request
+	clock   clock
+	started time.Time
+	hook    BodyReadHook
+	read    int64
+	once    sync.Once
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.body.Close()
+	b.done()
+	return err
+}
+
+func (b *observedBody) done() {
+	b.once.Do(func() {
+		b.hook(b.req, b.read, b.clock.Now().Sub(b.started))
+	})
+}
+
+// observeResponseBody wraps the body to call the hook when it is consumed.
+func observeResponseBody(req *http.Request, resp *http.Response, clk clock, started time.Time, hook BodyReadHook) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	resp.Body = &observedBody{body: resp.Body, req: req, clock: clk, started: started, hook: hook}
+}
+
+// bufferResponseBody reads the whole response body and replaces it with
+// a reader over the buffered bytes. It returns ErrIncompleteResponse when
+// the body is truncated.
+func bufferResponseBody(resp *http.Response) error {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(ErrIncompleteResponse, err.Error())
+	}
+	if resp.ContentLength >= 0 && int64(len(body)) != resp.ContentLength {
+		return errors.Wrapf(ErrIncompleteResponse, "read %d of %d bytes", len(body), resp.ContentLength)
+	}
+	return nil
+}
+
+// failedReader fails every read with err.
+type failedReader struct{ err error }
+
+func (r failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// emptyResponseBody buffers the response body and reports whether it is
+// empty. A read error is returned to the caller once the buffered bytes
+// are consumed, and the body is then not considered empty.
+func emptyResponseBody(resp *http.Response) bool {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return true
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	var r io.Reader = bytes.NewReader(body)
+	if err != nil {
+		r = io.MultiReader(r, failedReader{err})
+	}
+	resp.Body = ioutil.NopCloser(r)
+	return len(body) == 0 && err == nil
+}
+
+// validateResponse runs the validators in order and returns the first
+// error. The body is read once and rewound for every validator and for
+// the caller.
+func validateResponse(resp *http.Response, validators []func(*http.Response) error) error {
+	var body []byte
+	if resp.Body != nil && resp.Body != http.NoBody {
+		b, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "validate - read body failed")
+		}
+		body = b
+	}
+	rewind := func() {
+		if body != nil {
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+	}
+	defer rewind()
+	for _, validate := range validators {
+		rewind()
+		if err := validate(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statusSnippetSize is the number of body bytes kept in an
+// UnexpectedStatusError.
+const statusSnippetSize = 512
+
+// expectStatus returns an UnexpectedStatusError when the status code of
+// the response is not in expected.
+func expectStatus(resp *http.Response, expected map[int]bool) error {
+	if expected[resp.StatusCode] {
+		return nil
+	}
+	snippet, err := Peek(resp, statusSnippetSize)
+	if err != nil {
+		return err
+	}
+	return &UnexpectedStatusError{StatusCode: resp.StatusCode, Body: snippet}
+}
+
+// Peek returns up to the first n bytes of the response body without
+// consuming them: the body is rewrapped so it is still read from the
+// start. A body shorter than n is returned whole.
+func Peek(resp *http.Response, n int) ([]byte, error) {
+	if resp.Body == nil || resp.Body == http.NoBody || n <= 0 {
+		return nil, nil
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(resp.Body, buf)
+	buf = buf[:read]
+	body := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), body), body}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, errors.Wrap(err, "peek - read body failed")
+	}
+	return append([]byte(nil), buf...), nil
+}
+
+// ResolveLocation returns the Location header of the response resolved
+// against the URL of the request which produced it. It is useful when
+// redirects are followed manually, see WithNoRedirect.
+func ResolveLocation(resp *http.Response) (string, error) {
+	u, err := resp.Location()
+	if err != nil {
+		return "", errors.Wrap(err, "location - resolve failed")
+	}
+	return u.String(), nil
+}
+
+// capturedBody keeps the first max bytes read from the body and passes
+// them to the sink once max bytes are read, on EOF or on Close, whichever
+// comes first.
+type capturedBody struct {
+	body io.ReadCloser
+	max  int
+	buf  []byte
+	sink func(prefix []byte)
+	once sync.Once
+}
+
+func (b *capturedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if rest := b.max - len(b.buf); rest > 0 {
+		if n < rest {
+			rest = n
+		}
+		b.buf = append(b.buf, p[:rest]...)
+	}
+	if err == io.EOF || len(b.buf) >= b.max {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *capturedBody) Close() error {
+	err := b.body.Close()
+	b.done()
+	return err
+}
+
+func (b *capturedBody) done() {
+	b.once.Do(func() {
+		b.sink(b.buf)
+	})
+}
+
+// captureBody passes up to captureMax bytes of the body to the capture
+// sink as the body is read, nothing is read ahead of the caller.
+func (c *HttpClient) captureBody(resp *http.Response) {
+	sink := func(prefix []byte) {
+		c.guard("body capture", func() { c.captureSink(prefix) })
+	}
+	if resp.Body == nil || resp.Body == http.NoBody {
+		sink(nil)
+		return
+	}
+	resp.Body = &capturedBody{body: resp.Body, max: int(c.captureMax), sink: sink}
+}
+
+// ReadBody reads the whole response body and closes it, even when the read
+// fails. A nil response or body reads as empty.
+func ReadBody(resp *http.Response) ([]byte, error) {
+	if resp == nil || resp.Body == nil {
+		return []byte{}, nil
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return body, errors.Wrap(err, "read body failed")
+	}
+	return body, nil
+}
+
+// ReadBodyString is like ReadBody but returns the body as a string.
+func ReadBodyString(resp *http.Response) (string, error) {
+	body, err := ReadBody(resp)
+	return string(body), err
+}
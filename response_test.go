@@ -0,0 +1,239 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLocation(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://google.com/a/b?q=1", nil)
+	assert.Nil(t, err)
+
+	for location, want := range map[string]string{
+		"c":                    "https://google.com/a/c",
+		"/c":                   "https://google.com/c",
+		"../c?x=2":             "https://google.com/c?x=2",
+		"//other.com/c":        "https://other.com/c",
+		"http://other.com/c/d": "http://other.com/c/d",
+	} {
+		resp := &http.Response{
+			Header:  http.Header{"Location": {location}},
+			Request: req,
+		}
+		have, err := ResolveLocation(resp)
+		assert.Nil(t, err)
+		assert.Equal(t, want, have)
+	}
+
+	_, err = ResolveLocation(&http.Response{Header: http.Header{}, Request: req})
+	assert.True(t, errors.Is(err, http.ErrNoLocation))
+}
+
+func TestHttpClient_MaxResponseBodySize(t *testing.T) {
+	const limit = 16
+	client, doer, done := newClient(t, WithMaxResponseBodySize(limit))
+	defer done()
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+
+	for size, wantErr := range map[int]bool{limit - 1: false, limit: false, limit + 1: true} {
+		payload := bytes.Repeat([]byte("a"), size)
+		doer.EXPECT().Do(req).Times(1).Return(&http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(payload)),
+		}, nil)
+		resp, err := client.Do(req)
+		assert.Nil(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		if wantErr {
+			assert.True(t, errors.Is(err, ErrBodyTooLarge))
+			assert.Equal(t, payload[:limit], b)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, payload, b)
+		}
+	}
+}
+
+func TestHttpClient_AfterResponseBodyRead(t *testing.T) {
+	var calls int
+	var bytesRead int64
+	var elapsed time.Duration
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t, withClock(clk), WithAfterResponseBodyRead(func(req *http.Request, n int64, d time.Duration) {
+		calls++
+		bytesRead = n
+		elapsed = d
+		assert.Equal(t, "/file", req.URL.Path)
+	}))
+	defer done()
+
+	payload := []byte("hello world")
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		clk.Sleep(10 * time.Millisecond)
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(payload))}, nil
+	})
+	req, err := http.NewRequest(http.MethodGet, "https://google.com/file", nil)
+	assert.Nil(t, err)
+	resp, err := client.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, calls)
+
+	// the elapsed time is measured with the client clock
+	clk.Sleep(5 * time.Millisecond)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, body)
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(len(payload)), bytesRead)
+	assert.Equal(t, 15*time.Millisecond, elapsed)
+}
+
+func TestHttpClient_ResponseValidators(t *testing.T) {
+	validationErr := errors.New("missing field")
+	var calls []string
+	readBody := func(resp *http.Response) string {
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.Nil(t, err)
+		return string(b)
+	}
+	client, doer, done := newClient(t, WithResponseValidators(
+		func(resp *http.Response) error {
+			calls = append(calls, "status:"+readBody(resp))
+			return nil
+		},
+		func(resp *http.Response) error {
+			calls = append(calls, "schema:"+readBody(resp))
+			return validationErr
+		},
+		func(resp *http.Response) error {
+			calls = append(calls, "headers")
+			return nil
+		},
+	))
+	defer done()
+
+	body := newTrackingBody([]byte(`{"id":1}`))
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 200, Body: body}, nil)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	resp, err := client.Do(req)
+	assert.Equal(t, validationErr, err)
+	assert.Equal(t, []string{`status:{"id":1}`, `schema:{"id":1}`}, calls)
+	assert.Equal(t, 1, body.closed)
+	assert.Equal(t, `{"id":1}`, readBody(resp))
+}
+
+func TestPeek(t *testing.T) {
+	body := newTrackingBody([]byte("%PDF-1.7 document"))
+	resp := &http.Response{Body: body}
+
+	prefix, err := Peek(resp, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "%PDF-", string(prefix))
+	b, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "%PDF-1.7 document", string(b))
+	assert.Nil(t, resp.Body.Close())
+	assert.Equal(t, 1, body.closed)
+
+	// shorter than n
+	resp = &http.Response{Body: ioutil.NopCloser(bytes.NewReader([]byte("abc")))}
+	prefix, err = Peek(resp, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(prefix))
+	b, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(b))
+}
+
+func TestReadBody(t *testing.T) {
+	body := newTrackingBody([]byte(`{"id":1}`))
+	b, err := ReadBody(&http.Response{Body: body})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"id":1}`), b)
+	assert.Equal(t, 1, body.closed)
+
+	s, err := ReadBodyString(&http.Response{Body: newTrackingBody([]byte("text"))})
+	assert.Nil(t, err)
+	assert.Equal(t, "text", s)
+
+	for _, resp := range []*http.Response{nil, {}, {Body: http.NoBody}} {
+		b, err := ReadBody(resp)
+		assert.Nil(t, err)
+		assert.Empty(t, b)
+	}
+
+	readErr := errors.New("connection reset")
+	failing := &trackingBody{r: io.MultiReader(bytes.NewReader([]byte("par")), failedReader{readErr})}
+	b, err = ReadBody(&http.Response{Body: failing})
+	assert.Equal(t, readErr, errors.Cause(err))
+	assert.Equal(t, []byte("par"), b)
+	assert.Equal(t, 1, failing.closed)
+}
+
+func TestHttpClient_ResponseBodyCapture(t *testing.T) {
+	var captured []string
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithResponseBodyCapture(8, func(body []byte) {
+			captured = append(captured, string(body))
+		}),
+	)
+	defer done()
+
+	large := bytes.Repeat([]byte("0123456789"), 10000)
+	body := newTrackingBody(large)
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 502, Body: newTrackingBody([]byte("bad"))}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200, Body: body}, nil),
+	)
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"bad"}, captured)
+	// nothing is read ahead of the caller
+	assert.Equal(t, 0, body.read)
+
+	b, err := ReadBody(resp)
+	assert.Nil(t, err)
+	assert.Equal(t, large, b)
+	assert.Equal(t, 1, body.closed)
+	assert.Equal(t, []string{"bad", "01234567"}, captured)
+}
+
+func TestHttpClient_ResponseBodyCaptureStream(t *testing.T) {
+	var captured []string
+	client, doer, done := newClient(t,
+		WithResponseBodyCapture(8, func(body []byte) {
+			captured = append(captured, string(body))
+		}),
+	)
+	defer done()
+
+	pr, pw := io.Pipe()
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200, Body: pr}, nil)
+	// Do returns before anything is written to the stream
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Empty(t, captured)
+
+	go func() {
+		_, _ = pw.Write([]byte("data"))
+		_ = pw.Close()
+	}()
+	b, err := ReadBody(resp)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("data"), b)
+	assert.Equal(t, []string{"data"}, captured)
+}
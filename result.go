@@ -0,0 +1,46 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Result is the outcome of DoWithResult: the response returned by Do and
+// how it was obtained.
+type Result struct {
+	*http.Response
+	// Attempts is the number of attempts dispatched to the Doer, 0 when
+	// the response came from the cache.
+	Attempts int
+	// TotalDuration is the time spent in Do, retries and waits included.
+	TotalDuration time.Duration
+	// LastError is the error of the last failed attempt, nil if none.
+	LastError error
+}
+
+type resultKey struct{}
+
+// DoWithResult is like Do but returns the response within a Result
+// reporting the attempts made. The error is the one returned by Do.
+func (c *HttpClient) DoWithResult(req *http.Request) (*Result, error) {
+	result := &Result{}
+	started := c.clock.Now()
+	resp, err := c.Do(req.WithContext(context.WithValue(req.Context(), resultKey{}, result)))
+	result.Response = resp
+	result.TotalDuration = c.clock.Now().Sub(started)
+	return result, err
+}
+
+// recordResult reports the attempts of the retry loop to the Result of
+// DoWithResult, if the request is made by it.
+func recordResult(req *http.Request, retryErr *RetryError) {
+	result, ok := req.Context().Value(resultKey{}).(*Result)
+	if !ok {
+		return
+	}
+	result.Attempts += retryErr.Attempts
+	if len(retryErr.Errors) > 0 {
+		result.LastError = retryErr.Errors[len(retryErr.Errors)-1]
+	}
+}
@@ -0,0 +1,42 @@
+package httpclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_DoWithResult(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t,
+		withClock(clk),
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 100 * time.Millisecond }),
+	)
+	defer done()
+
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(nil, someErr),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 503}, nil),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil),
+	)
+	req, err := http.NewRequest(http.MethodGet, "https://google.com", nil)
+	assert.Nil(t, err)
+	result, err := client.DoWithResult(req)
+	// errors of earlier attempts are still reported
+	assert.Error(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, 3, result.Attempts)
+	assert.Equal(t, 200*time.Millisecond, result.TotalDuration)
+	assert.Equal(t, someErr, result.LastError)
+
+	doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 201}, nil)
+	result, err = client.DoWithResult(req)
+	assert.Nil(t, err)
+	assert.Equal(t, 201, result.StatusCode)
+	assert.Equal(t, 1, result.Attempts)
+	assert.Nil(t, result.LastError)
+}
@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_GracefulShutdownDuringBackOff(t *testing.T) {
+	client, doer, done := newClient(t,
+		WithRetryCount(3),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return time.Hour }),
+		WithGracefulShutdown(time.Second),
+	)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 503, Body: http.NoBody}, nil)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	resp, err := client.Get(ctx, "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestHttpClient_GracefulShutdownInFlight(t *testing.T) {
+	slowDoer := func(d time.Duration) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			select {
+			case <-time.After(d):
+				return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		})
+	}
+
+	// the attempt finishes within the grace window
+	cli, err := New(WithDoer(slowDoer(50*time.Millisecond)), WithGracefulShutdown(time.Second))
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	resp, err := cli.Get(ctx, "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the attempt is aborted once the grace window is over
+	cli, err = New(WithDoer(slowDoer(time.Hour)), WithGracefulShutdown(20*time.Millisecond))
+	assert.Nil(t, err)
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = cli.Get(ctx, "https://google.com", nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second)
+}
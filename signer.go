@@ -0,0 +1,31 @@
+package httpclient
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Signer signs a request, e.g. with AWS Signature Version 4, by setting
+// its headers or query. Sign is called before every attempt, retries
+// included, so time sensitive signatures are computed afresh. The request
+// body can be read to hash the payload, it is rewound before being sent.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is an adapter to allow the use of ordinary functions as Signer.
+type SignerFunc func(req *http.Request) error
+
+// Sign calls f(req).
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
+// sign signs the attempt request and rewinds the body read by the signer.
+func (c *HttpClient) sign(req *http.Request) error {
+	if err := c.signer.Sign(req); err != nil {
+		return errors.Wrap(err, "sign - request signing failed")
+	}
+	return rewindBody(req)
+}
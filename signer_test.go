@@ -0,0 +1,73 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_RequestSigner(t *testing.T) {
+	payload := `{"test":"test"}`
+	sum := sha256.Sum256([]byte(payload))
+	payloadHash := hex.EncodeToString(sum[:])
+
+	var signed int
+	signer := SignerFunc(func(req *http.Request) error {
+		b, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		sum := sha256.Sum256(b)
+		signed++
+		req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+		req.Header.Set("Authorization", "signature-"+strconv.Itoa(signed))
+		return nil
+	})
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithRetryableMethods(http.MethodPut),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithRequestSigner(signer),
+	)
+	defer done()
+
+	var signatures []string
+	record := func(code int) func(*http.Request) (*http.Response, error) {
+		return func(req *http.Request) (*http.Response, error) {
+			b, err := ioutil.ReadAll(req.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, payload, string(b))
+			assert.Equal(t, payloadHash, req.Header.Get("X-Amz-Content-Sha256"))
+			signatures = append(signatures, req.Header.Get("Authorization"))
+			return &http.Response{StatusCode: code}, nil
+		}
+	}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(record(503)),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(record(200)),
+	)
+	resp, err := client.Put(context.Background(), "https://s3.amazonaws.com/bucket/key", strings.NewReader(payload), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{"signature-1", "signature-2"}, signatures)
+}
+
+func TestHttpClient_RequestSignerError(t *testing.T) {
+	signErr := errors.New("no credentials")
+	client, _, done := newClient(t, WithRequestSigner(SignerFunc(func(req *http.Request) error {
+		return signErr
+	})))
+	defer done()
+
+	resp, err := client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, resp)
+	assert.Equal(t, signErr, errors.Cause(err))
+}
@@ -0,0 +1,139 @@
+package httpclient
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStreamReconnectWait is the wait before reconnecting a stream when
+// the server did not set one with the retry field.
+const DefaultStreamReconnectWait = 3 * time.Second
+
+// maxEventLineSize bounds the length of a line of an event stream.
+const maxEventLineSize = 1 << 20
+
+// Event is a Server-Sent Event read by Stream.
+type Event struct {
+	// ID is the last event ID of the stream, set by this event or an
+	// earlier one.
+	ID string
+	// Event is the event type, empty for the default "message" type.
+	Event string
+	// Data holds the data lines of the event joined with "\n".
+	Data string
+}
+
+// Stream makes a HTTP GET request to a Server-Sent Events endpoint and
+// emits the events it receives until the stream ends or the context is
+// done, then the channel is closed. The request is retried according to
+// the client policies until the stream is established; a response other
+// than 200 OK is returned as an UnexpectedStatusError. With
+// WithStreamReconnect an ended stream is requested again with the
+// Last-Event-ID header. The timeout of the default http client bounds the
+// whole stream, see WithTimeout.
+func (c *HttpClient) Stream(ctx context.Context, url string, headers http.Header) (<-chan Event, error) {
+	resp, err := c.openStream(ctx, url, headers, "")
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		var lastID string
+		for {
+			wait := c.readEvents(ctx, resp.Body, events, &lastID)
+			_ = resp.Body.Close()
+			if !c.streamReconnect || ctx.Err() != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.clock.After(wait):
+			}
+			if resp, err = c.openStream(ctx, url, headers, lastID); err != nil {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// openStream requests the event stream, resuming after lastID if set.
+func (c *HttpClient) openStream(ctx context.Context, url string, headers http.Header, lastID string) (*http.Response, error) {
+	request, err := c.newRequest(ctx, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+	request.Header.Set("Cache-Control", "no-cache")
+	if len(lastID) > 0 {
+		request.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := c.Do(request)
+	if err != nil {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		return nil, err
+	}
+	if err := expectStatus(resp, map[int]bool{http.StatusOK: true}); err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readEvents parses the event stream and sends its events until the body
+// ends or the context is done. It returns the wait requested by the
+// server before reconnecting.
+func (c *HttpClient) readEvents(ctx context.Context, body io.Reader, events chan<- Event, lastID *string) time.Duration {
+	wait := DefaultStreamReconnectWait
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxEventLineSize)
+	var event Event
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			if len(data) > 0 {
+				event.ID = *lastID
+				event.Data = strings.Join(data, "\n")
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return wait
+				}
+			}
+			event, data = Event{}, nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				*lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms >= 0 {
+				wait = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return wait
+}
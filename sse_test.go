@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventStream(body string) *http.Response {
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func collectEvents(events <-chan Event) []Event {
+	var collected []Event
+	for event := range events {
+		collected = append(collected, event)
+	}
+	return collected
+}
+
+func TestHttpClient_Stream(t *testing.T) {
+	client, doer, done := newClient(t)
+	defer done()
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "text/event-stream", req.Header.Get("Accept"))
+		assert.Equal(t, "", req.Header.Get("Last-Event-ID"))
+		return eventStream(": keep alive\n\n" +
+			"data: first\n\n" +
+			"event: update\nid: 7\ndata: {\"a\":1}\ndata:{\"b\":2}\n\n" +
+			"id\n\n" +
+			"data\n\n" +
+			"event: ignored\n\n" +
+			"retry: 10\ndata: last\n\n" +
+			"data: unterminated"), nil
+	})
+	events, err := client.Stream(context.Background(), "https://example.com/events", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Data: "first"},
+		{ID: "7", Event: "update", Data: "{\"a\":1}\n{\"b\":2}"},
+		// an empty data field still dispatches an event
+		{Data: ""},
+		{Data: "last"},
+	}, collectEvents(events))
+}
+
+func TestHttpClient_StreamReconnect(t *testing.T) {
+	clk := &fakeClock{now: time.Unix(0, 0)}
+	client, doer, done := newClient(t, withClock(clk), WithStreamReconnect())
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			return eventStream("retry: 250\nid: 1\ndata: a\n\n"), nil
+		}),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "1", req.Header.Get("Last-Event-ID"))
+			return eventStream("id: 2\ndata: b\n\n"), nil
+		}),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "2", req.Header.Get("Last-Event-ID"))
+			return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody}, nil
+		}),
+	)
+	events, err := client.Stream(ctx, "https://example.com/events", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{{ID: "1", Data: "a"}, {ID: "2", Data: "b"}}, collectEvents(events))
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, DefaultStreamReconnectWait}, clk.waits)
+}
+
+func TestHttpClient_StreamCanceled(t *testing.T) {
+	client, doer, done := newClient(t)
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(eventStream("data: a\n\ndata: b\n\n"), nil)
+	events, err := client.Stream(ctx, "https://example.com/events", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, Event{Data: "a"}, <-events)
+	cancel()
+	for range events {
+	}
+
+	doer.EXPECT().Do(gomock.Any()).Times(1).Return(&http.Response{StatusCode: 404, Body: http.NoBody}, nil)
+	_, err = client.Stream(context.Background(), "https://example.com/events", nil)
+	var statusErr *UnexpectedStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, 404, statusErr.StatusCode)
+}
@@ -0,0 +1,70 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// TokenSource supplies the bearer token of a request. It is called before
+// every attempt with the request context, so an expired token can be
+// refreshed between retries.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenInvalidator is implemented by a TokenSource caching its token. The
+// token is invalidated when the server answers 401 Unauthorized, before
+// the request is sent once more with a new token.
+type TokenInvalidator interface {
+	Invalidate()
+}
+
+// TokenSourceFunc is an adapter to allow the use of ordinary functions as
+// TokenSource.
+type TokenSourceFunc func(ctx context.Context) (string, error)
+
+// Token calls f(ctx).
+func (f TokenSourceFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// authorize sets the bearer token of the token source on the request.
+func (c *HttpClient) authorize(req *http.Request) error {
+	token, err := c.tokenSource.Token(req.Context())
+	if err != nil {
+		return errors.Wrap(err, "token - fetch failed")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// prepareAttempt authorizes and signs the request of an attempt.
+func (c *HttpClient) prepareAttempt(req *http.Request) error {
+	if c.tokenSource != nil {
+		if err := c.authorize(req); err != nil {
+			return err
+		}
+	}
+	if c.signer != nil {
+		return c.sign(req)
+	}
+	return nil
+}
+
+// reauthorize sends the request once more with a new token when the
+// response is 401 Unauthorized and the body can be replayed.
+func (c *HttpClient) reauthorize(ctx context.Context, req *http.Request, attempt int, resp *http.Response) (*http.Response, error) {
+	if invalidator, ok := c.tokenSource.(TokenInvalidator); ok {
+		invalidator.Invalidate()
+	}
+	c.discardResponse(resp)
+	if err := rewindBody(req); err != nil {
+		return nil, err
+	}
+	if err := c.prepareAttempt(req); err != nil {
+		return nil, err
+	}
+	return c.dispatch(ctx, req, attempt)
+}
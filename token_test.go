@@ -0,0 +1,99 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type rotatingTokenSource struct {
+	issued      int
+	invalidated int
+}
+
+func (s *rotatingTokenSource) Token(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.issued++
+	return "token-" + strconv.Itoa(s.issued), nil
+}
+
+func (s *rotatingTokenSource) Invalidate() {
+	s.invalidated++
+}
+
+func TestHttpClient_TokenSource(t *testing.T) {
+	source := &rotatingTokenSource{}
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithTokenSource(source),
+	)
+	defer done()
+
+	var tokens []string
+	respond := func(code int) func(*http.Request) (*http.Response, error) {
+		return func(req *http.Request) (*http.Response, error) {
+			tokens = append(tokens, req.Header.Get("Authorization"))
+			return &http.Response{StatusCode: code}, nil
+		}
+	}
+
+	// 401 then 200 within the first attempt
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(401)),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(200)),
+	)
+	resp, err := client.Get(context.Background(), "https://google.com", http.Header{"Authorization": {"Bearer stale"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, tokens)
+	assert.Equal(t, 1, source.invalidated)
+
+	// a new token for every retry
+	tokens = nil
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(503)),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(200)),
+	)
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer token-3", "Bearer token-4"}, tokens)
+
+	// 401 is sent once more only
+	tokens = nil
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(401)),
+		doer.EXPECT().Do(gomock.Any()).DoAndReturn(respond(401)),
+	)
+	resp, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 401, resp.StatusCode)
+	assert.Equal(t, []string{"Bearer token-5", "Bearer token-6"}, tokens)
+}
+
+func TestHttpClient_TokenSourceError(t *testing.T) {
+	client, _, done := newClient(t, WithTokenSource(&rotatingTokenSource{}))
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp, err := client.Get(ctx, "https://google.com", nil)
+	assert.Nil(t, resp)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+
+	tokenErr := errors.New("refresh failed")
+	client, _, done = newClient(t, WithTokenSource(TokenSourceFunc(func(ctx context.Context) (string, error) {
+		return "", tokenErr
+	})))
+	defer done()
+	_, err = client.Get(context.Background(), "https://google.com", nil)
+	assert.Equal(t, tokenErr, errors.Cause(err))
+}
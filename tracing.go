@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans around requests and their attempts. It mirrors the
+// subset of the OpenTelemetry tracing API used by the client. The
+// otelhttpclient module adapts an otel tracer provider to it.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx and returns
+	// the context carrying the new span.
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+	// Inject writes the trace context of ctx into the outgoing headers.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// startSpan starts the span covering the whole Do call including retries.
+func (c *HttpClient) startSpan(req *http.Request) (context.Context, Span) {
+	if c.tracer == nil {
+		return req.Context(), nil
+	}
+	ctx, span := c.tracer.Start(req.Context(), "HTTP "+req.Method)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+	return ctx, span
+}
+
+// startAttemptSpan starts the child span of a single attempt and injects
+// its trace context into the request headers.
+func (c *HttpClient) startAttemptSpan(ctx context.Context, req *http.Request, attempt int) Span {
+	if c.tracer == nil {
+		return nil
+	}
+	ctx, span := c.tracer.Start(ctx, "HTTP "+req.Method+" attempt")
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+	span.SetAttribute("http.retry_count", attempt)
+	c.tracer.Inject(ctx, req.Header)
+	return span
+}
+
+// endSpan records the outcome of the request on the span and ends it.
+func endSpan(span Span, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	if resp != nil {
+		span.SetAttribute("http.status_code", resp.StatusCode)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
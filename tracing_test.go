@@ -0,0 +1,94 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+type fakeSpan struct {
+	id     int
+	parent int
+	name   string
+	attrs  map[string]interface{}
+	errs   []error
+	ended  bool
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *fakeSpan) RecordError(err error)                      { s.errs = append(s.errs, err) }
+func (s *fakeSpan) End()                                       { s.ended = true }
+
+type fakeTracer struct {
+	spans []*fakeSpan
+}
+
+func (f *fakeTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	span := &fakeSpan{id: len(f.spans) + 1, name: spanName, attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(spanKey{}).(*fakeSpan); ok {
+		span.parent = parent.id
+	}
+	f.spans = append(f.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (f *fakeTracer) Inject(ctx context.Context, header http.Header) {
+	span := ctx.Value(spanKey{}).(*fakeSpan)
+	header.Set("Traceparent", strconv.Itoa(span.id))
+}
+
+func TestHttpClient_Tracer(t *testing.T) {
+	tracer := &fakeTracer{}
+	client, doer, done := newClient(t,
+		WithRetryCount(1),
+		WithBackOff(func(attemptNum int, resp *http.Response) time.Duration { return 0 }),
+		WithTracer(tracer),
+	)
+	defer done()
+	var traceparents []string
+	record := func(req *http.Request) {
+		traceparents = append(traceparents, req.Header.Get("Traceparent"))
+	}
+	gomock.InOrder(
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 500}, nil).Do(record),
+		doer.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: 200}, nil).Do(record),
+	)
+	_, err := client.Get(context.TODO(), "http://test.com/path", nil)
+	assert.Nil(t, err)
+
+	assert.Len(t, tracer.spans, 3)
+	root, first, second := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	assert.Equal(t, "HTTP GET", root.name)
+	assert.Equal(t, 0, root.parent)
+	assert.Equal(t, http.MethodGet, root.attrs["http.method"])
+	assert.Equal(t, "http://test.com/path", root.attrs["http.url"])
+	assert.Equal(t, 200, root.attrs["http.status_code"])
+	assert.True(t, root.ended)
+	for i, span := range []*fakeSpan{first, second} {
+		assert.Equal(t, "HTTP GET attempt", span.name)
+		assert.Equal(t, root.id, span.parent)
+		assert.Equal(t, i, span.attrs["http.retry_count"])
+		assert.True(t, span.ended)
+	}
+	assert.Equal(t, 500, first.attrs["http.status_code"])
+	assert.Equal(t, 200, second.attrs["http.status_code"])
+	assert.Equal(t, []string{"2", "3"}, traceparents)
+
+	// errors are recorded
+	tracer.spans = nil
+	doer.EXPECT().Do(gomock.Any()).Times(2).Return(nil, someErr)
+	_, err = client.Get(context.TODO(), "http://test.com/path", nil)
+	assert.Error(t, err)
+	assert.Len(t, tracer.spans, 3)
+	for _, span := range tracer.spans {
+		assert.NotEmpty(t, span.errs)
+		assert.True(t, span.ended)
+	}
+}
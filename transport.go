@@ -0,0 +1,78 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultDialTimeout = 30 * time.Second
+	DefaultKeepAlive   = 30 * time.Second
+)
+
+// defaultTransport returns the transport of the default http client,
+// creating it on first use. A transport set with WithTransport is cloned
+// before the first change so the caller's one is left untouched. Options
+// configuring the transport share the clone.
+func (c *HttpClient) defaultTransport() *http.Transport {
+	if c.ownTransport != nil {
+		return c.ownTransport
+	}
+	t, ok := c.transport.(*http.Transport)
+	if !ok || t == nil {
+		t = http.DefaultTransport.(*http.Transport)
+	}
+	c.ownTransport = t.Clone()
+	c.ownTLS = true
+	c.transport = c.ownTransport
+	return c.ownTransport
+}
+
+// tlsConfig returns the TLS configuration of the default transport,
+// creating it on first use. A configuration set with WithTLSConfig is
+// cloned before the first change.
+func (c *HttpClient) tlsConfig() *tls.Config {
+	t := c.defaultTransport()
+	switch {
+	case t.TLSClientConfig == nil:
+		t.TLSClientConfig = &tls.Config{}
+	case !c.ownTLS:
+		t.TLSClientConfig = t.TLSClientConfig.Clone()
+	}
+	c.ownTLS = true
+	return t.TLSClientConfig
+}
+
+// setErr records a configuration error, keeping the first one reported.
+func (c *HttpClient) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// dialContext dials the address using the dial timeout configured for its
+// host, or the Unix socket set with WithUnixSocket instead of the address.
+func (c *HttpClient) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := net.Dialer{
+		Timeout:   c.hostDialTimeout(addr),
+		KeepAlive: DefaultKeepAlive,
+	}
+	if len(c.unixSocket) > 0 {
+		return dialer.DialContext(ctx, "unix", c.unixSocket)
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (c *HttpClient) hostDialTimeout(addr string) time.Duration {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if timeout, ok := c.hostDialTimeouts[host]; ok {
+		return timeout
+	}
+	return c.dialTimeout
+}
@@ -0,0 +1,47 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoBaseURL is returned by WarmUp when the client has no base URL.
+var ErrNoBaseURL = errors.New("base url is not set")
+
+// WarmUp opens n connections to the base URL host by sending n concurrent
+// HEAD requests to the base URL, so the first requests of real traffic
+// don't pay for the dial and the TLS handshake. The requests are neither
+// retried nor observed. The transport only keeps MaxIdleConnsPerHost idle
+// connections per host, 2 by default, so it should be raised to keep n.
+// The first error is returned once all requests are done.
+func (c *HttpClient) WarmUp(ctx context.Context, n int) error {
+	if c.baseURL == "" {
+		return ErrNoBaseURL
+	}
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() { errs <- c.warmUpConn(ctx) }()
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if connErr := <-errs; err == nil {
+			err = connErr
+		}
+	}
+	return err
+}
+
+func (c *HttpClient) warmUpConn(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "warm up - request creation failed")
+	}
+	resp, err := c.doer(req).Do(req)
+	if err != nil {
+		return errors.Wrap(err, "warm up - request failed")
+	}
+	c.discardResponse(resp)
+	return nil
+}
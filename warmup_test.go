@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpClient_WarmUp(t *testing.T) {
+	var mu sync.Mutex
+	var arrived int
+	allArrived := make(chan struct{})
+	var newConns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			// hold the warm up requests until all of them have a connection
+			mu.Lock()
+			arrived++
+			if arrived == 3 {
+				close(allArrived)
+			}
+			mu.Unlock()
+			<-allArrived
+		}
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConns, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	cli, err := New(
+		WithBaseURL(server.URL),
+		WithTransport(&http.Transport{MaxIdleConnsPerHost: 3}),
+	)
+	assert.Nil(t, err)
+	assert.Nil(t, cli.WarmUp(context.Background(), 3))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&newConns))
+
+	var reused int
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				reused++
+			}
+		},
+	}
+	for i := 0; i < 3; i++ {
+		ctx := httptrace.WithClientTrace(context.Background(), trace)
+		resp, err := cli.Get(ctx, "/", nil)
+		assert.Nil(t, err)
+		assert.Nil(t, resp.Body.Close())
+	}
+	assert.Equal(t, 3, reused)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&newConns))
+
+	cli, err = New()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrNoBaseURL, cli.WarmUp(context.Background(), 1))
+}